@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+// account is an SMTP2GO account and the client querying it. Its name is
+// empty when the account is given on the command line.
+type account struct {
+	name   string
+	client *internal.Client
+}
+
+// accountClient creates the client of an account of the configuration file.
+func (o *options) accountClient(cfg *internal.Config, a internal.AccountConfig) (*internal.Client, error) {
+	key, err := a.Key()
+	if err != nil {
+		return nil, err
+	}
+	apiURL := a.APIURL
+	if apiURL == "" {
+		apiURL = o.apiURL
+	}
+	return o.newClient(cfg, a.Name, apiURL, key)
+}
+
+// selectAccount restricts accounts to the named one, if any.
+func selectAccount(accounts []account, name string) ([]account, error) {
+	if name == "" {
+		return accounts, nil
+	}
+	for _, a := range accounts {
+		if a.name == name {
+			return []account{a}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown account %q", name)
+}
+
+// registerCollectors registers the enabled collectors of every account on
+// reg, labelling their metrics with the account name when it is set. Email
+// addresses are exported through pseudonymizer if not nil.
+func registerCollectors(reg prometheus.Registerer, cfg *internal.Config, accounts []account, pseudonymizer *internal.Pseudonymizer) {
+	for _, a := range accounts {
+		r := reg
+		if a.name != "" {
+			r = prometheus.WrapRegistererWith(prometheus.Labels{"account": a.name}, reg)
+		}
+		r.MustRegister(a.client)
+		r.MustRegister(internal.NewCollectors(a.client, cfg, pseudonymizer)...)
+	}
+	reg.MustRegister(internal.ParseErrors)
+}
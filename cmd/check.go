@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+// runCheck is a Nagios plugin checking the statistics of an account against
+// thresholds.
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	var opts options
+	opts.register(flags)
+	accountName := flags.String("account", "", "Account of the configuration file to check, required when there are several")
+	var overrides internal.Thresholds
+	registerThresholds(flags, &overrides)
+	if err := flags.Parse(args); err != nil {
+		os.Exit(int(internal.SeverityUnknown))
+	}
+
+	unknown := func(err error) {
+		fmt.Printf("SMTP2GO %s - %v\n", internal.SeverityUnknown, err)
+		os.Exit(int(internal.SeverityUnknown))
+	}
+	cfg, accounts, err := opts.load()
+	if err != nil {
+		unknown(err)
+	}
+	if accounts, err = selectAccount(accounts, *accountName); err != nil {
+		unknown(err)
+	}
+	if len(accounts) > 1 {
+		unknown(fmt.Errorf("several accounts are configured, select one with -account"))
+	}
+
+	thresholds := mergeThresholds(overrides, cfg.Thresholds).WithDefaults()
+	if err := thresholds.Validate(); err != nil {
+		unknown(err)
+	}
+
+	status, err := internal.FetchStatus(accounts[0].client, "check", false)
+	severity := writeCheck(os.Stdout, thresholds.Evaluate(status), status, err)
+	os.Exit(int(severity))
+}
+
+// registerThresholds defines the flags overriding the threshold levels on
+// flags.
+func registerThresholds(flags *flag.FlagSet, t *internal.Thresholds) {
+	flags.Var(levelFlag{&t.CycleRemainingPercent.Warning}, "cycle-remaining.warning", "Warn when less than this percentage of the cycle quota remains")
+	flags.Var(levelFlag{&t.CycleRemainingPercent.Critical}, "cycle-remaining.critical", "Critical when less than this percentage of the cycle quota remains")
+	flags.Var(levelFlag{&t.BouncePercent.Warning}, "bounce.warning", "Warn when the bounce percentage is above this level")
+	flags.Var(levelFlag{&t.BouncePercent.Critical}, "bounce.critical", "Critical when the bounce percentage is above this level")
+	flags.Var(levelFlag{&t.SpamPercent.Warning}, "spam.warning", "Warn when the spam percentage is above this level")
+	flags.Var(levelFlag{&t.SpamPercent.Critical}, "spam.critical", "Critical when the spam percentage is above this level")
+}
+
+// levelFlag is a flag setting a threshold level.
+type levelFlag struct {
+	level **float64
+}
+
+func (f levelFlag) String() string {
+	if f.level == nil || *f.level == nil {
+		return ""
+	}
+	return strconv.FormatFloat(**f.level, 'f', -1, 64)
+}
+
+func (f levelFlag) Set(s string) error {
+	level, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*f.level = &level
+	return nil
+}
+
+// mergeThresholds returns the levels of t, completed by those of base.
+func mergeThresholds(t, base internal.Thresholds) internal.Thresholds {
+	merge := func(t *internal.Threshold, base internal.Threshold) {
+		if t.Warning == nil {
+			t.Warning = base.Warning
+		}
+		if t.Critical == nil {
+			t.Critical = base.Critical
+		}
+	}
+	merge(&t.CycleRemainingPercent, base.CycleRemainingPercent)
+	merge(&t.BouncePercent, base.BouncePercent)
+	merge(&t.SpamPercent, base.SpamPercent)
+	return t
+}
+
+// writeCheck writes the results in the Nagios plugin format, followed by
+// fetch errors as long output, and returns the overall severity.
+func writeCheck(w io.Writer, results []internal.CheckResult, status *internal.Status, fetchErr error) internal.Severity {
+	severity := internal.SeverityOK
+	var summary, perfdata []string
+	for _, result := range results {
+		if result.Severity.Worse(severity) {
+			severity = result.Severity
+		}
+		summary = append(summary, checkSummary(result))
+
+		warning, critical := formatLevel(result.Threshold.Warning, result.Below), formatLevel(result.Threshold.Critical, result.Below)
+		value := perfValue(result.Value)
+		if result.Value.Valid {
+			value += "%"
+		}
+		perfdata = append(perfdata, fmt.Sprintf("%s=%s;%s;%s;0;100", result.Name, value, warning, critical))
+	}
+	if cycle := status.Cycle; cycle != nil {
+		perfdata = append(perfdata, fmt.Sprintf("cycle_used=%s;;;0;%s", perfValue(cycle.CycleUsed), formatNumber(cycle.CycleMax, -1)))
+	}
+
+	fmt.Fprintf(w, "SMTP2GO %s - %s | %s\n", severity, strings.Join(summary, ", "), strings.Join(perfdata, " "))
+	if fetchErr != nil {
+		fmt.Fprintln(w, fetchErr)
+	}
+	return severity
+}
+
+// checkSummary describes a result, with the level it breaches if any.
+func checkSummary(result internal.CheckResult) string {
+	if !result.Value.Valid {
+		return result.Name + " unknown"
+	}
+	s := fmt.Sprintf("%s %s%%", result.Name, formatNumber(result.Value, 2))
+	level := result.Threshold.Warning
+	if result.Severity == internal.SeverityCritical {
+		level = result.Threshold.Critical
+	}
+	if result.Severity != internal.SeverityOK {
+		op := ">"
+		if result.Below {
+			op = "<"
+		}
+		s += fmt.Sprintf(" (%s %s)", op, strconv.FormatFloat(*level, 'f', -1, 64))
+	}
+	return s
+}
+
+// formatLevel formats a level as a Nagios range, "n:" alerting below n.
+func formatLevel(level *float64, below bool) string {
+	if level == nil {
+		return ""
+	}
+	s := strconv.FormatFloat(*level, 'f', -1, 64)
+	if below {
+		s += ":"
+	}
+	return s
+}
+
+// perfValue formats a performance data value, "U" when it is unknown.
+func perfValue(n internal.Number) string {
+	if !n.Valid {
+		return "U"
+	}
+	return strconv.FormatFloat(n.Value, 'f', -1, 64)
+}
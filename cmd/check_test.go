@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+func TestCheck(t *testing.T) {
+	_, a := newTestAccount(t, "")
+	status, err := internal.FetchStatus(a.client, "check", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	level := func(v float64) *float64 { return &v }
+	overrides := internal.Thresholds{BouncePercent: internal.Threshold{Warning: level(1), Critical: level(2)}}
+	thresholds := mergeThresholds(overrides, internal.Thresholds{}).WithDefaults()
+
+	var out bytes.Buffer
+	severity := writeCheck(&out, thresholds.Evaluate(status), status, nil)
+	if severity != internal.SeverityCritical {
+		t.Errorf("severity = %s, want CRITICAL", severity)
+	}
+	want := "SMTP2GO CRITICAL - cycle_remaining_percent 47.80%, bounce_percent 1.25% (> 1), spam_percent 0.50% (> 0.3)" +
+		" | cycle_remaining_percent=47.8%;20:;10:;0;100 bounce_percent=1.25%;1;2;0;100 spam_percent=0.5%;0.1;0.3;0;100 cycle_used=522;;;0;1000\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
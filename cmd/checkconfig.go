@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+// runCheckConfig validates a configuration file, exiting with status 1 if it
+// has problems.
+func runCheckConfig(args []string) {
+	flags := flag.NewFlagSet("check-config", flag.ExitOnError)
+	var opts options
+	opts.register(flags)
+	test := flags.Bool("test", false, "Test the credentials of each account by calling /stats/email_cycle")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s check-config [options] [file]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	path := opts.configFile
+	if flags.NArg() > 0 {
+		path = flags.Arg(0)
+	}
+	if path == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var tester func(*internal.Config, internal.AccountConfig) error
+	if *test {
+		tester = func(cfg *internal.Config, a internal.AccountConfig) error {
+			client, err := opts.accountClient(cfg, a)
+			if err != nil {
+				return err
+			}
+			return testCredentials(client)
+		}
+	}
+	problems, err := internal.CheckConfig(path, tester)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Without accounts in the file, test the one of the command line.
+	if *test && len(problems) == 0 {
+		opts.configFile = path
+		if cfg, accounts, err := opts.load(); err != nil {
+			problems = append(problems, &internal.ConfigError{Err: err})
+		} else if len(cfg.Accounts) == 0 {
+			if err := testCredentials(accounts[0].client); err != nil {
+				problems = append(problems, &internal.ConfigError{Err: fmt.Errorf("credential test failed: %w", err)})
+			}
+		}
+	}
+
+	if writeProblems(os.Stdout, path, problems) {
+		os.Exit(1)
+	}
+}
+
+// testCredentials checks that the API accepts the key of client.
+func testCredentials(client *internal.Client) error {
+	_, err := client.Fetch("/stats/email_cycle", "check-config")
+	return err
+}
+
+// writeProblems lists the problems of the configuration file at path, in the
+// "file:line: message" format of compilers, and reports whether there were
+// any.
+func writeProblems(w io.Writer, path string, problems []*internal.ConfigError) bool {
+	for _, problem := range problems {
+		if problem.Line > 0 {
+			fmt.Fprintf(w, "%s:%d: %v\n", path, problem.Line, problem)
+		} else {
+			fmt.Fprintf(w, "%s: %v\n", path, problem)
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(w, "%s: %d problem(s) found\n", path, len(problems))
+		return true
+	}
+	fmt.Fprintf(w, "%s: OK\n", path)
+	return false
+}
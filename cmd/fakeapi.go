@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal/fakeapi"
+)
+
+// runFakeAPI serves a simulated SMTP2GO API, for staging environments and
+// local development.
+func runFakeAPI(args []string) {
+	flags := flag.NewFlagSet("fake-api", flag.ExitOnError)
+	scenarioFile := flags.String("scenario", "", "Path to a YAML scenario file (a built-in scenario is used by default)")
+	listenAddr := flags.String("listen", ":22113", "Address to serve the fake API on")
+	apiKey := flags.String("apiKey", "", "API key accepted by the fake API (any key by default)")
+	debug := flags.Bool("debug", false, "Enable debug logging")
+	flags.Parse(args)
+
+	scenario := fakeapi.DefaultScenario()
+	if *scenarioFile != "" {
+		var err error
+		if scenario, err = fakeapi.LoadScenario(*scenarioFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Mount the API under /v3 as well, so that the base URL of the exporter
+	// only needs its host changed.
+	server := fakeapi.NewServer(scenario, *apiKey, *debug)
+	mux := http.NewServeMux()
+	mux.Handle("/", server)
+	mux.Handle("/v3/", http.StripPrefix("/v3", server))
+
+	log.Printf("Starting fake SMTP2GO API on %s...\n", *listenAddr)
+	if err := http.ListenAndServe(*listenAddr, mux); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+//go:generate go run . gen-dashboard -o ../mixin/dashboards/smtp2go.json
+
+// runGenDashboard writes the Grafana dashboard of the metrics of the
+// exporter.
+func runGenDashboard(args []string) {
+	flags := flag.NewFlagSet("gen-dashboard", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to an optional YAML configuration file, whose collectors and thresholds are used")
+	output := flags.String("o", "-", "File to write the dashboard to (- for stdout)")
+	var overrides internal.Thresholds
+	registerThresholds(flags, &overrides)
+	flags.Parse(args)
+
+	cfg := &internal.Config{}
+	if *configFile != "" {
+		var err error
+		if cfg, err = internal.LoadConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	thresholds := mergeThresholds(overrides, cfg.Thresholds).WithDefaults()
+	if err := thresholds.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	dashboard := internal.GenerateDashboard(internal.Metrics(cfg), thresholds)
+
+	w := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeDashboard(w, dashboard); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeDashboard writes a dashboard in JSON.
+func writeDashboard(w io.Writer, dashboard internal.Dashboard) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dashboard)
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+	"go.yaml.in/yaml/v3"
+)
+
+//go:generate go run . gen-rules -o ../mixin/rules.yaml
+
+// runGenRules writes the Prometheus recording and alerting rules watching
+// the metrics of the exporter.
+func runGenRules(args []string) {
+	flags := flag.NewFlagSet("gen-rules", flag.ExitOnError)
+	configFile := flags.String("config", "", "Path to an optional YAML configuration file, whose collectors, thresholds and failed_api_calls levels are used")
+	output := flags.String("o", "-", "File to write the rules to (- for stdout)")
+	defaults := internal.DefaultRuleOptions()
+	job := flags.String("job", defaults.Job, "Scrape job of the exporter, for the alert on the exporter being down (empty to leave it out)")
+	forDuration := flags.Duration("for", defaults.For, "How long a condition must hold before its alert fires")
+	forecastRange := flags.Duration("forecast-range", defaults.ForecastRange, "Range over which the pace of the cycle usage is measured")
+	var overrides internal.Thresholds
+	registerThresholds(flags, &overrides)
+	flags.Parse(args)
+
+	cfg := &internal.Config{}
+	if *configFile != "" {
+		var err error
+		if cfg, err = internal.LoadConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	thresholds := mergeThresholds(overrides, cfg.Thresholds).WithDefaults()
+	if err := thresholds.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	rules := internal.GenerateRules(internal.Metrics(cfg), internal.RuleOptions{
+		Thresholds:    thresholds,
+		Job:           *job,
+		For:           *forDuration,
+		ForecastRange: *forecastRange,
+
+		FailedAPICalls:       cfg.Alerting.FailedAPICallsOrDefault(),
+		FailedAPICallsWindow: cfg.Alerting.FailedAPICallsWindowOrDefault(),
+	})
+
+	w := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeRules(w, rules); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeRules writes a rule file in YAML.
+func writeRules(w io.Writer, rules internal.RuleFile) error {
+	if _, err := io.WriteString(w, "# Generated by \"smtp2go_exporter gen-rules\", do not edit.\n"); err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(rules); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
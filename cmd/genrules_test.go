@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+// TestMixinRules checks that the rules of the mixin are up to date. Run
+// "go generate ./cmd" to regenerate them.
+func TestMixinRules(t *testing.T) {
+	var out bytes.Buffer
+	rules := internal.GenerateRules(internal.Metrics(&internal.Config{}), internal.DefaultRuleOptions())
+	if err := writeRules(&out, rules); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../mixin/rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != string(want) {
+		t.Error("mixin/rules.yaml is outdated, run \"go generate ./cmd\"")
+	}
+}
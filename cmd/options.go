@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+// options holds the command-line options shared by the commands querying
+// the SMTP2GO API.
+type options struct {
+	apiURL           string
+	apiKey           string
+	debug            bool
+	configFile       string
+	apiTimeout       time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	recordDir        string
+	replayDir        string
+	stateDir         string
+}
+
+// register defines the options on flags.
+func (o *options) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.apiURL, "apiURL", "https://api.smtp2go.com/v3", "Base URL of the API (e.g., https://api.smtp2go.com/v3)")
+	flags.StringVar(&o.apiKey, "apiKey", "", "API key for authentication")
+	flags.BoolVar(&o.debug, "debug", false, "Enable debug logging")
+	flags.StringVar(&o.configFile, "config", "", "Path to an optional YAML configuration file")
+	flags.DurationVar(&o.apiTimeout, "api.timeout", 8*time.Second, "Maximum time spent on an API call, retries included; the calls of a scrape also end before its timeout")
+	flags.IntVar(&o.breakerThreshold, "api.breaker-threshold", 3, "Consecutive failures after which calls to an endpoint are suspended (0 to disable)")
+	flags.DurationVar(&o.breakerCooldown, "api.breaker-cooldown", time.Minute, "Time calls to a failing endpoint stay suspended before a new attempt")
+	flags.StringVar(&o.recordDir, "record.dir", "", "Directory where every API response is saved, with the API key redacted")
+	flags.StringVar(&o.replayDir, "replay.dir", "", "Directory of recorded API responses to serve instead of calling the API")
+	flags.StringVar(&o.stateDir, "state.dir", "", "Directory where the usage of previous cycles is kept across restarts")
+}
+
+// load reads the configuration file and creates a client per account.
+func (o *options) load() (*internal.Config, []account, error) {
+	if o.recordDir != "" && o.replayDir != "" {
+		return nil, nil, fmt.Errorf("options -record.dir and -replay.dir are mutually exclusive")
+	}
+
+	cfg := &internal.Config{}
+	if o.configFile != "" {
+		var err error
+		if cfg, err = internal.LoadConfig(o.configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(cfg.Accounts) == 0 {
+		if o.replayDir == "" && (o.apiURL == "" || o.apiKey == "") {
+			return nil, nil, fmt.Errorf("option -apiKey must be provided")
+		}
+		client, err := o.newClient(cfg, "", o.apiURL, o.apiKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cfg, []account{{client: client}}, nil
+	}
+
+	if o.apiKey != "" {
+		return nil, nil, fmt.Errorf("option -apiKey cannot be used with accounts in the configuration file")
+	}
+	var accounts []account
+	for _, a := range cfg.Accounts {
+		client, err := o.accountClient(cfg, a)
+		if err != nil {
+			return nil, nil, err
+		}
+		accounts = append(accounts, account{name: a.Name, client: client})
+	}
+	return cfg, accounts, nil
+}
+
+// newClient creates the client of an account. Recordings and state of named
+// accounts are kept in their own subdirectory. The recording directory is
+// created up front, so that a scrape does not silently fail to record.
+func (o *options) newClient(cfg *internal.Config, name, apiURL, apiKey string) (*internal.Client, error) {
+	recordDir, replayDir, stateDir := o.recordDir, o.replayDir, o.stateDir
+	if name != "" {
+		if stateDir != "" {
+			stateDir = filepath.Join(stateDir, name)
+		}
+		if recordDir != "" {
+			recordDir = filepath.Join(recordDir, name)
+		}
+		if replayDir != "" {
+			replayDir = filepath.Join(replayDir, name)
+		}
+	}
+	if recordDir != "" {
+		if err := os.MkdirAll(recordDir, 0o755); err != nil {
+			return nil, fmt.Errorf("cannot create recording directory: %w", err)
+		}
+	}
+
+	return internal.NewClient(internal.ClientOptions{
+		// Remove trailing slash from base URL
+		APIURL:           strings.TrimRight(apiURL, "/"),
+		APIKey:           apiKey,
+		Debug:            o.debug,
+		Timeout:          o.apiTimeout,
+		BreakerThreshold: o.breakerThreshold,
+		BreakerCooldown:  o.breakerCooldown,
+
+		RequestsPerSecond: cfg.Budget.RequestsPerSecond(),
+		Burst:             cfg.Budget.BurstOrDefault(),
+		MinIntervals:      cfg.MinIntervals(),
+
+		RecordDir: recordDir,
+		ReplayDir: replayDir,
+		StateDir:  stateDir,
+	}), nil
+}
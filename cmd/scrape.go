@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+// runScrape collects every enabled collector once and prints the result,
+// exiting with status 1 if any of them failed.
+func runScrape(args []string) {
+	flags := flag.NewFlagSet("scrape", flag.ExitOnError)
+	var opts options
+	opts.register(flags)
+	output := flags.String("output", "text", "Output format: text (Prometheus exposition format) or json")
+	accountName := flags.String("account", "", "Only scrape the named account of the configuration file")
+	flags.Parse(args)
+
+	if *output != "text" && *output != "json" {
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	cfg, accounts, err := opts.load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if accounts, err = selectAccount(accounts, *accountName); err != nil {
+		log.Fatal(err)
+	}
+
+	pseudonymizer, err := internal.NewPseudonymizer(cfg.EmailHistory.Privacy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	reg := prometheus.NewRegistry()
+	registerCollectors(reg, cfg, accounts, pseudonymizer)
+	failed, err := scrape(os.Stdout, reg, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range failed {
+		log.Printf("Collector %s failed", name)
+	}
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// scrape gathers the metrics of reg, writes them to w in the given format and
+// returns the collectors which failed, as "account/collector" when the
+// account is named.
+func scrape(w io.Writer, reg prometheus.Gatherer, output string) ([]string, error) {
+	families, err := reg.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []string
+	for _, family := range families {
+		if family.GetName() != "smtp2go_scrape_collector_success" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetGauge().GetValue() != 0 {
+				continue
+			}
+			labels := labelMap(metric)
+			name := labels["collector"]
+			if labels["account"] != "" {
+				name = labels["account"] + "/" + name
+			}
+			failed = append(failed, name)
+		}
+	}
+
+	if output == "json" {
+		return failed, writeJSON(w, families)
+	}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return nil, err
+		}
+	}
+	return failed, nil
+}
+
+// jsonFamily is the JSON representation of a metric family.
+type jsonFamily struct {
+	Name    string       `json:"name"`
+	Help    string       `json:"help"`
+	Type    string       `json:"type"`
+	Metrics []jsonMetric `json:"metrics"`
+}
+
+// jsonMetric is the JSON representation of a sample.
+type jsonMetric struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+func writeJSON(w io.Writer, families []*dto.MetricFamily) error {
+	out := []jsonFamily{}
+	for _, family := range families {
+		f := jsonFamily{
+			Name: family.GetName(),
+			Help: family.GetHelp(),
+			Type: familyType(family.GetType()),
+		}
+		for _, metric := range family.GetMetric() {
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				value = metric.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				value = metric.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = metric.GetUntyped().GetValue()
+			default:
+				return fmt.Errorf("metric %s: unsupported type %s", family.GetName(), family.GetType())
+			}
+			f.Metrics = append(f.Metrics, jsonMetric{Labels: labelMap(metric), Value: value})
+		}
+		out = append(out, f)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// familyType returns the lower-case name of a metric type.
+func familyType(t dto.MetricType) string {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return "counter"
+	case dto.MetricType_GAUGE:
+		return "gauge"
+	default:
+		return "untyped"
+	}
+}
+
+func labelMap(metric *dto.Metric) map[string]string {
+	labels := map[string]string{}
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+// newTestAccount starts a fake API and returns an account using it.
+func newTestAccount(t *testing.T, name string) (*smtp2gotest.Server, account) {
+	t.Helper()
+	return newTestAccountWith(t, options{apiTimeout: 5 * time.Second}, name)
+}
+
+// newTestAccountWith is like newTestAccount, creating the client with opts.
+func newTestAccountWith(t *testing.T, opts options, name string) (*smtp2gotest.Server, account) {
+	t.Helper()
+	server := smtp2gotest.NewServer()
+	server.APIKey = "test-key"
+	t.Cleanup(server.Close)
+
+	client, err := opts.newClient(&internal.Config{}, name, server.URL, "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, account{name: name, client: client}
+}
+
+func TestScrapeText(t *testing.T) {
+	_, a := newTestAccount(t, "")
+	reg := prometheus.NewRegistry()
+	registerCollectors(reg, &internal.Config{}, []account{a}, nil)
+
+	var out bytes.Buffer
+	failed, err := scrape(&out, reg, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) > 0 {
+		t.Errorf("failed collectors: %v", failed)
+	}
+	if !strings.Contains(out.String(), "smtp2go_email_cycle_used 522\n") {
+		t.Errorf("missing cycle usage in output:\n%s", out.String())
+	}
+}
+
+func TestScrapeJSONFailure(t *testing.T) {
+	server, a := newTestAccount(t, "main")
+	server.SetResponse("/stats/email_spam", smtp2gotest.Error(400))
+	reg := prometheus.NewRegistry()
+	registerCollectors(reg, &internal.Config{}, []account{a}, nil)
+
+	var out bytes.Buffer
+	failed, err := scrape(&out, reg, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0] != "main/email_spam" {
+		t.Errorf("failed collectors = %v, want [main/email_spam]", failed)
+	}
+
+	var families []jsonFamily
+	if err := json.Unmarshal(out.Bytes(), &families); err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.Name != "smtp2go_email_cycle_max" {
+			continue
+		}
+		if len(family.Metrics) != 1 || family.Metrics[0].Labels["account"] != "main" || family.Metrics[0].Value != 1000 {
+			t.Errorf("unexpected cycle max %+v", family.Metrics)
+		}
+		return
+	}
+	t.Error("missing smtp2go_email_cycle_max")
+}
+
+func TestScrapeRecordNamedAccount(t *testing.T) {
+	dir := t.TempDir()
+	_, a := newTestAccountWith(t, options{apiTimeout: 5 * time.Second, recordDir: dir}, "main")
+	reg := prometheus.NewRegistry()
+	registerCollectors(reg, &internal.Config{}, []account{a}, nil)
+
+	if _, err := scrape(io.Discard, reg, "text"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(filepath.Join(dir, "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Error("no response recorded for the named account")
+	}
+}
+
+func TestNewClientRecordDirError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := options{recordDir: file}
+	if _, err := opts.newClient(&internal.Config{}, "main", "http://localhost", "test-key"); err == nil {
+		t.Error("expected an error when the recording directory cannot be created")
+	}
+}
@@ -18,7 +18,9 @@ import (
 	"flag"
 	"log"
 	"net/http"
-	"strings"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -26,34 +28,95 @@ import (
 )
 
 func main() {
-	apiURL := flag.String("apiURL", "https://api.smtp2go.com/v3", "Base URL of the API (e.g., https://api.smtp2go.com/v3)")
-	apiKey := flag.String("apiKey", "", "API key for authentication")
-	debug := flag.Bool("debug", false, "Enable debug logging")
-	listenAddr := flag.String("listen", ":22112", "Address to expose metrics")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fake-api":
+			runFakeAPI(os.Args[2:])
+			return
+		case "scrape":
+			runScrape(os.Args[2:])
+			return
+		case "status":
+			runStatus(os.Args[2:])
+			return
+		case "check":
+			runCheck(os.Args[2:])
+			return
+		case "check-config":
+			runCheckConfig(os.Args[2:])
+			return
+		case "gen-rules":
+			runGenRules(os.Args[2:])
+			return
+		case "gen-dashboard":
+			runGenDashboard(os.Args[2:])
+			return
+		}
+	}
 
+	var opts options
+	opts.register(flag.CommandLine)
+	listenAddr := flag.String("listen", ":22112", "Address to expose metrics")
 	flag.Parse()
 
-	if *apiURL == "" || *apiKey == "" {
-		log.Fatal("Option -apiKey must be provided")
+	cfg, accounts, err := opts.load()
+	if err != nil {
+		log.Fatal(err)
 	}
+	pseudonymizer, err := internal.NewPseudonymizer(cfg.EmailHistory.Privacy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	registerCollectors(prometheus.DefaultRegisterer, cfg, accounts, pseudonymizer)
 
-	// Remove trailing slash from base URL
-	*apiURL = strings.TrimRight(*apiURL, "/")
-
-	// Register all collectors
-	emailCycle := internal.NewEmailCycleCollector(*apiURL, *apiKey, *debug)
-	emailBounces := internal.NewEmailBouncesCollector(*apiURL, *apiKey, *debug)
-	emailHistory := internal.NewEmailHistoryCollector(*apiURL, *apiKey, *debug)
-	emailSpam := internal.NewEmailSpamCollector(*apiURL, *apiKey, *debug)
-	emailUnsubs := internal.NewEmailUnsubsCollector(*apiURL, *apiKey, *debug)
+	if lookup := cfg.EmailHistory.Privacy.Lookup.Listen; lookup != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/lookup", pseudonymizer)
+		go func() {
+			log.Printf("Serving email address lookups on %s...\n", lookup)
+			log.Fatal(http.ListenAndServe(lookup, mux))
+		}()
+	}
 
-	prometheus.MustRegister(emailCycle)
-	prometheus.MustRegister(emailBounces)
-	prometheus.MustRegister(emailHistory)
-	prometheus.MustRegister(emailSpam)
-	prometheus.MustRegister(emailUnsubs)
+	if len(cfg.Alerting.Notifiers) > 0 {
+		thresholds := cfg.Thresholds.WithDefaults()
+		go runAlerting(internal.NewEvaluator(cfg.Alerting, thresholds), cfg.Alerting.IntervalOrDefault(), accounts)
+	}
 
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", withScrapeDeadline(promhttp.Handler(), accounts))
 	log.Printf("Starting exporter on %s...\n", *listenAddr)
 	log.Fatal(http.ListenAndServe(*listenAddr, nil))
 }
+
+// runAlerting evaluates the thresholds of every account at each interval.
+func runAlerting(evaluator *internal.Evaluator, interval time.Duration, accounts []account) {
+	log.Printf("Evaluating alerts every %s...\n", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, a := range accounts {
+			evaluator.Evaluate(a.name, a.client)
+		}
+		<-ticker.C
+	}
+}
+
+// scrapeMargin is the part of the scrape timeout kept to write the response
+// once the API calls are over.
+const scrapeMargin = 500 * time.Millisecond
+
+// withScrapeDeadline bounds the API calls made by the clients of accounts
+// while serving a scrape by the timeout Prometheus announces, so that the
+// retries of every call together end before the scrape does.
+func withScrapeDeadline(next http.Handler, accounts []account) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64); err == nil {
+			timeout := time.Duration(seconds * float64(time.Second))
+			deadline := time.Now().Add(max(timeout-scrapeMargin, timeout/2))
+			for _, a := range accounts {
+				defer a.client.StartScrape(deadline)()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
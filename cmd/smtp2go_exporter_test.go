@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestScrapeDeadline(t *testing.T) {
+	server, a := newTestAccountWith(t, options{apiTimeout: time.Minute}, "")
+	server.SetResponse("/stats/email_cycle", smtp2gotest.Error(http.StatusServiceUnavailable))
+	reg := prometheus.NewRegistry()
+	registerCollectors(reg, &internal.Config{}, []account{a}, nil)
+	handler := withScrapeDeadline(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), []account{a})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "2")
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("scrape took %s, longer than its timeout", elapsed)
+	}
+	if server.RequestCount("/stats/email_cycle") < 2 {
+		t.Error("the failing call was not retried within the scrape")
+	}
+}
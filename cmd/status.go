@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+// historyColumns are the numeric fields of the per-sender table, in display
+// order.
+var historyColumns = []string{"used", "bytecount", "avgsize", "bounces", "clicks", "opens", "rejects", "spam", "unsubscribes"}
+
+// accountStatus is the status of a named account.
+type accountStatus struct {
+	Account string `json:"account,omitempty"`
+	*internal.Status
+	CycleRemainingSeconds *float64 `json:"cycle_remaining_seconds,omitempty"`
+}
+
+// runStatus prints the statistics of the configured accounts for humans,
+// exiting with status 1 if some of them could not be fetched.
+func runStatus(args []string) {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	var opts options
+	opts.register(flags)
+	output := flags.String("output", "table", "Output format: table, json or csv (per-sender table only)")
+	sortBy := flags.String("sort", "used", "Column the per-sender table is sorted by: email_address or "+strings.Join(historyColumns, ", "))
+	accountName := flags.String("account", "", "Only show the named account of the configuration file")
+	flags.Parse(args)
+
+	if *output != "table" && *output != "json" && *output != "csv" {
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	if *sortBy != "email_address" && !slices.Contains(historyColumns, *sortBy) {
+		log.Fatalf("Unknown sort column %q", *sortBy)
+	}
+	_, accounts, err := opts.load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if accounts, err = selectAccount(accounts, *accountName); err != nil {
+		log.Fatal(err)
+	}
+
+	var statuses []accountStatus
+	failed := false
+	for _, a := range accounts {
+		status, err := internal.FetchStatus(a.client, "status", true)
+		if err != nil {
+			log.Printf("Failed to fetch statistics of %s: %v", accountLabel(a.name), err)
+			failed = true
+		}
+		sortHistory(status.History, *sortBy)
+		statuses = append(statuses, accountStatus{Account: a.name, Status: status})
+	}
+
+	switch *output {
+	case "json":
+		err = writeStatusJSON(os.Stdout, statuses)
+	case "csv":
+		err = writeStatusCSV(os.Stdout, statuses)
+	default:
+		err = writeStatusTable(os.Stdout, statuses)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// accountLabel names an account in messages.
+func accountLabel(name string) string {
+	if name == "" {
+		return "the account"
+	}
+	return "account " + name
+}
+
+// sortHistory sorts senders by address, or by decreasing value of a column.
+func sortHistory(history []internal.EmailHistoryEntry, column string) {
+	sort.SliceStable(history, func(i, j int) bool {
+		if column == "email_address" {
+			return history[i].EmailAddress < history[j].EmailAddress
+		}
+		a, b := history[i].Values()[column], history[j].Values()[column]
+		if a.Valid != b.Valid {
+			return a.Valid
+		}
+		return a.Value > b.Value
+	})
+}
+
+func writeStatusJSON(w io.Writer, statuses []accountStatus) error {
+	for i, status := range statuses {
+		if status.CycleRemaining != nil {
+			seconds := status.CycleRemaining.Seconds()
+			statuses[i].CycleRemainingSeconds = &seconds
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+func writeStatusCSV(w io.Writer, statuses []accountStatus) error {
+	out := csv.NewWriter(w)
+	out.Write(append([]string{"account", "email_address"}, historyColumns...))
+	for _, status := range statuses {
+		for _, entry := range status.History {
+			record := []string{status.Account, entry.EmailAddress}
+			values := entry.Values()
+			for _, column := range historyColumns {
+				record = append(record, formatNumber(values[column], -1))
+			}
+			out.Write(record)
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func writeStatusTable(w io.Writer, statuses []accountStatus) error {
+	for i, status := range statuses {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if status.Account != "" {
+			fmt.Fprintf(w, "Account:      %s\n", status.Account)
+		}
+
+		if cycle := status.Cycle; cycle != nil {
+			remaining := "unknown"
+			if status.CycleRemaining != nil {
+				remaining = formatDuration(*status.CycleRemaining)
+			}
+			fmt.Fprintf(w, "Cycle:        %s to %s (%s left)\n", cycle.CycleStart, cycle.CycleEnd, remaining)
+			fmt.Fprintf(w, "Usage:        %s %s / %s used, %s remaining\n",
+				progressBar(cycle.CycleUsed, cycle.CycleMax, 30),
+				formatNumber(cycle.CycleUsed, 0), formatNumber(cycle.CycleMax, 0), formatNumber(cycle.CycleRemaining, 0))
+		} else {
+			fmt.Fprintln(w, "Cycle:        unavailable")
+		}
+
+		var rates []string
+		if status.Bounces != nil {
+			rates = append(rates, "bounces "+formatNumber(status.Bounces.BouncePercent, 2)+"%")
+		}
+		if status.Spam != nil {
+			rates = append(rates, "spam "+formatNumber(status.Spam.SpamPercent, 2)+"%")
+		}
+		if status.Unsubs != nil {
+			rates = append(rates, "unsubscribes "+formatNumber(status.Unsubs.UnsubscribePercent, 2)+"%")
+		}
+		if len(rates) > 0 {
+			fmt.Fprintf(w, "Rates:        %s\n", strings.Join(rates, ", "))
+		}
+
+		if len(status.History) == 0 {
+			continue
+		}
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		header := []string{"EMAIL ADDRESS"}
+		for _, column := range historyColumns {
+			header = append(header, strings.ToUpper(column))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, entry := range status.History {
+			row := []string{entry.EmailAddress}
+			values := entry.Values()
+			for _, column := range historyColumns {
+				row = append(row, formatNumber(values[column], 0))
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// progressBar draws used/max as a bar of the given width followed by its
+// percentage.
+func progressBar(used, max internal.Number, width int) string {
+	if !used.Valid || !max.Valid || max.Value <= 0 {
+		return "[" + strings.Repeat("?", width) + "]     ?"
+	}
+	fraction := math.Min(math.Max(used.Value/max.Value, 0), 1)
+	filled := int(math.Round(fraction * float64(width)))
+	return fmt.Sprintf("[%s%s] %5.1f%%", strings.Repeat("#", filled), strings.Repeat("-", width-filled), 100*used.Value/max.Value)
+}
+
+// formatNumber formats n with the given number of decimals, or as few as
+// needed when negative, and a dash when it is missing.
+func formatNumber(n internal.Number, decimals int) string {
+	if !n.Valid {
+		return "-"
+	}
+	return strconv.FormatFloat(n.Value, 'f', decimals, 64)
+}
+
+// formatDuration formats d in days, hours and minutes.
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		return "0m"
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal"
+)
+
+func TestStatusTable(t *testing.T) {
+	_, a := newTestAccount(t, "main")
+	status, err := internal.FetchStatus(a.client, "status", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortHistory(status.History, "spam")
+
+	var out bytes.Buffer
+	if err := writeStatusTable(&out, []accountStatus{{Account: "main", Status: status}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Account:      main\n",
+		"[################--------------]  52.2% 522 / 1000 used, 478 remaining\n",
+		"Rates:        bounces 1.25%, spam 0.50%, unsubscribes 0.75%\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in output:\n%s", want, out.String())
+		}
+	}
+	if bob, alice := strings.Index(out.String(), "bob@"), strings.Index(out.String(), "alice@"); bob > alice {
+		t.Errorf("senders not sorted by spam:\n%s", out.String())
+	}
+}
+
+func TestStatusCSV(t *testing.T) {
+	history := []internal.EmailHistoryEntry{
+		{EmailAddress: "b@example.tld", Used: internal.Number{Value: 1, Valid: true}},
+		{EmailAddress: "a@example.tld", Used: internal.Number{Value: 2.5, Valid: true}},
+	}
+	sortHistory(history, "email_address")
+
+	var out bytes.Buffer
+	if err := writeStatusCSV(&out, []accountStatus{{Status: &internal.Status{History: history}}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "account,email_address,used,bytecount,avgsize,bounces,clicks,opens,rejects,spam,unsubscribes\n" +
+		",a@example.tld,2.5,-,-,-,-,-,-,-,-\n" +
+		",b@example.tld,1,-,-,-,-,-,-,-,-\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		-time.Minute:                  "0m",
+		90 * time.Second:              "1m",
+		3*time.Hour + 5*time.Minute:   "3h 5m",
+		8*24*time.Hour + 12*time.Hour: "8d 12h",
+	} {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccountConfig is an SMTP2GO account.
+type AccountConfig struct {
+	Name string `yaml:"name"`
+	// APIURL defaults to the -apiURL command-line option.
+	APIURL string `yaml:"api_url"`
+	// Exactly one of APIKey and APIKeyFile must be set.
+	APIKey     string `yaml:"api_key"`
+	APIKeyFile string `yaml:"api_key_file"`
+}
+
+// Key returns the API key of the account, reading it from its file if
+// needed, and fails if it is blank.
+func (a AccountConfig) Key() (string, error) {
+	key, err := readSecret(a.APIKey, a.APIKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("account %s: %w", a.Name, err)
+	}
+	return key, nil
+}
+
+// accountProblems checks that the accounts are named uniquely and have an
+// API key.
+func accountProblems(accounts []AccountConfig) []*ConfigError {
+	var problems []*ConfigError
+	report := func(path string, format string, args ...any) {
+		problems = append(problems, &ConfigError{Path: path, Err: fmt.Errorf(format, args...)})
+	}
+
+	names := map[string]bool{}
+	for i, account := range accounts {
+		path := fmt.Sprintf("accounts[%d]", i)
+		if account.Name == "" {
+			report(path, "accounts[%d]: account has no name", i)
+		} else if names[account.Name] {
+			report(path+".name", "account %s: duplicate name", account.Name)
+		}
+		names[account.Name] = true
+		if (account.APIKey == "") == (account.APIKeyFile == "") {
+			report(path, "account %s: exactly one of api_key and api_key_file must be set", account.Name)
+		} else if account.APIKeyFile == "" && strings.TrimSpace(account.APIKey) == "" {
+			report(path+".api_key", "account %s: api_key must not be blank", account.Name)
+		}
+	}
+	return problems
+}
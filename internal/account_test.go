@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccountKey(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(keyFile, []byte("file-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		account AccountConfig
+		key     string
+	}{
+		{AccountConfig{Name: "inline", APIKey: "inline-key"}, "inline-key"},
+		{AccountConfig{Name: "file", APIKeyFile: keyFile}, "file-key"},
+		{AccountConfig{Name: "empty", APIKeyFile: emptyFile}, ""},
+		{AccountConfig{Name: "missing", APIKeyFile: filepath.Join(dir, "missing")}, ""},
+	} {
+		key, err := tc.account.Key()
+		if key != tc.key || (err == nil) != (tc.key != "") {
+			t.Errorf("%s: got %q, %v, want %q", tc.account.Name, key, err, tc.key)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier types.
+const (
+	NotifierWebhook      = "webhook"
+	NotifierSlack        = "slack"
+	NotifierAlertmanager = "alertmanager"
+)
+
+// AlertingConfig holds the settings of the built-in alerting, which checks
+// the statistics of the collectors against the thresholds and notifies their
+// changes. It is disabled without notifiers.
+type AlertingConfig struct {
+	// Interval is the time between evaluations, one minute by default.
+	Interval time.Duration `yaml:"interval"`
+	// FailedAPICalls is breached when more requests to the API failed during
+	// FailedAPICallsWindow, retries included. Unset levels default to those
+	// of DefaultFailedAPICalls, and the window to 15 minutes.
+	FailedAPICalls       Threshold     `yaml:"failed_api_calls"`
+	FailedAPICallsWindow time.Duration `yaml:"failed_api_calls_window"`
+	// MaxDataAge is how old the statistics last fetched by the scrapes may
+	// be, beyond the minimum refresh interval of their collector, before
+	// they are no longer evaluated; three intervals by default.
+	MaxDataAge time.Duration    `yaml:"max_data_age"`
+	Notifiers  []NotifierConfig `yaml:"notifiers"`
+}
+
+// defaultFailedAPICallsWindow is the window over which failed requests are
+// counted by default.
+const defaultFailedAPICallsWindow = 15 * time.Minute
+
+// DefaultFailedAPICalls returns the levels of the failed requests to the API
+// used when none are set: a few failures are absorbed by the retries and the
+// cache, so only repeated ones are worth an alert.
+func DefaultFailedAPICalls() Threshold {
+	level := func(v float64) *float64 { return &v }
+	return Threshold{Warning: level(5), Critical: level(20)}
+}
+
+// NotifierConfig is a destination of the notifications of the built-in
+// alerting.
+type NotifierConfig struct {
+	// Type is NotifierWebhook, NotifierSlack or NotifierAlertmanager.
+	Type string `yaml:"type"`
+	// URL is the URL notifications are posted to, or the base URL of
+	// Alertmanager.
+	URL string `yaml:"url"`
+	// Timeout bounds each notification, ten seconds by default.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Validate checks the interval, the levels and the notifiers.
+func (c AlertingConfig) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("alerting: interval must not be negative")
+	}
+	if c.FailedAPICallsWindow < 0 {
+		return fmt.Errorf("alerting: failed_api_calls_window must not be negative")
+	}
+	if c.MaxDataAge < 0 {
+		return fmt.Errorf("alerting: max_data_age must not be negative")
+	}
+	failedCalls := c.FailedAPICallsOrDefault()
+	warning, critical := failedCalls.Warning, failedCalls.Critical
+	if *warning < 0 || *critical < 0 {
+		return fmt.Errorf("alerting: failed_api_calls: levels must not be negative")
+	}
+	if *critical < *warning {
+		return fmt.Errorf("alerting: failed_api_calls: critical level must not be below the warning one")
+	}
+	for i, notifier := range c.Notifiers {
+		switch notifier.Type {
+		case NotifierWebhook, NotifierSlack, NotifierAlertmanager:
+		default:
+			return fmt.Errorf("alerting: notifier %d: unknown type %q", i+1, notifier.Type)
+		}
+		if u, err := url.Parse(notifier.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("alerting: notifier %d: url must be an http or https URL", i+1)
+		}
+		if notifier.Timeout < 0 {
+			return fmt.Errorf("alerting: notifier %d: timeout must not be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// IntervalOrDefault returns the time between evaluations.
+func (c AlertingConfig) IntervalOrDefault() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return time.Minute
+}
+
+// MaxDataAgeOrDefault returns how old the statistics may be to be evaluated.
+func (c AlertingConfig) MaxDataAgeOrDefault() time.Duration {
+	if c.MaxDataAge > 0 {
+		return c.MaxDataAge
+	}
+	return 3 * c.IntervalOrDefault()
+}
+
+// FailedAPICallsOrDefault returns the levels of the failed requests to the
+// API, unset ones defaulting to those of DefaultFailedAPICalls.
+func (c AlertingConfig) FailedAPICallsOrDefault() Threshold {
+	failedCalls, defaults := c.FailedAPICalls, DefaultFailedAPICalls()
+	if failedCalls.Warning == nil {
+		failedCalls.Warning = defaults.Warning
+	}
+	if failedCalls.Critical == nil {
+		failedCalls.Critical = defaults.Critical
+	}
+	return failedCalls
+}
+
+// FailedAPICallsWindowOrDefault returns the window over which failed
+// requests to the API are counted.
+func (c AlertingConfig) FailedAPICallsWindowOrDefault() time.Duration {
+	if c.FailedAPICallsWindow > 0 {
+		return c.FailedAPICallsWindow
+	}
+	return defaultFailedAPICallsWindow
+}
+
+// alertNames are the names of the alerts notified to Alertmanager, by check,
+// those of the generated rules checking the same.
+var alertNames = map[string]string{
+	"cycle_remaining_percent": AlertCycleQuotaLow,
+	"bounce_percent":          AlertBounceRateHigh,
+	"spam_percent":            AlertSpamRateHigh,
+	"failed_api_calls":        AlertAPICallsFailing,
+}
+
+// Alert is a breached threshold of an account, or its resolution.
+type Alert struct {
+	// Name is the name of the check, e.g. "bounce_percent".
+	Name     string
+	Account  string
+	Severity Severity
+	Value    float64
+	// Summary describes the value and the level it breaches.
+	Summary  string
+	StartsAt time.Time
+	// EndsAt is set once the alert is resolved.
+	EndsAt time.Time
+}
+
+// Resolved reports whether the alert is over.
+func (a Alert) Resolved() bool {
+	return !a.EndsAt.IsZero()
+}
+
+func (a Alert) key() string {
+	return a.Account + "/" + a.Name
+}
+
+// Evaluator checks the statistics of accounts against thresholds, and
+// notifies the alerts which start, change severity or end. Alertmanager is
+// notified of every firing alert at each evaluation instead, as it expects.
+type Evaluator struct {
+	thresholds   Thresholds
+	failedCalls  Threshold
+	failedWindow time.Duration
+	interval     time.Duration
+	maxDataAge   time.Duration
+	notifiers    []*notifier
+
+	mutex sync.Mutex
+	// firing holds the firing alerts and latest the latest results, by
+	// key, and failures the numbers of failed API requests counted at the
+	// evaluations of the window, by account.
+	firing   map[string]Alert
+	latest   map[string]CheckResult
+	failures map[string][]failureCount
+}
+
+// failureCount is the number of failed API requests of an account at a
+// given time.
+type failureCount struct {
+	at    time.Time
+	count int
+}
+
+// notifier is a destination of notifications, and what it was last told.
+type notifier struct {
+	NotifierConfig
+	client *http.Client
+	// notified holds the alerts last notified, by key.
+	notified map[string]Alert
+}
+
+// NewEvaluator returns an evaluator checking thresholds and the failed API
+// calls of cfg, and notifying its notifiers.
+func NewEvaluator(cfg AlertingConfig, thresholds Thresholds) *Evaluator {
+	e := &Evaluator{
+		thresholds:   thresholds,
+		failedCalls:  cfg.FailedAPICallsOrDefault(),
+		failedWindow: cfg.FailedAPICallsWindowOrDefault(),
+		interval:     cfg.IntervalOrDefault(),
+		maxDataAge:   cfg.MaxDataAgeOrDefault(),
+		firing:       map[string]Alert{},
+		latest:       map[string]CheckResult{},
+		failures:     map[string][]failureCount{},
+	}
+	for _, n := range cfg.Notifiers {
+		timeout := n.Timeout
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+		e.notifiers = append(e.notifiers, &notifier{
+			NotifierConfig: n,
+			client:         &http.Client{Timeout: timeout},
+			notified:       map[string]Alert{},
+		})
+	}
+	return e
+}
+
+// Evaluate checks the statistics of the account of client last fetched by
+// their collectors, without calling the API, along with the API requests
+// which failed during the window, and notifies the changes. Statistics which
+// were never fetched or are outdated leave their alerts as they are.
+func (e *Evaluator) Evaluate(account string, client *Client) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	t := now()
+	status, _ := CollectedStatus(client, e.maxDataAge)
+	results := e.thresholds.Evaluate(status)
+	failed := Number{Value: float64(e.failedDuringWindow(account, client.Failures(), t)), Valid: true}
+	results = append(results, evaluate("failed_api_calls", failed, e.failedCalls, false))
+
+	for _, result := range results {
+		key := account + "/" + result.Name
+		e.latest[key] = result
+		switch result.Severity {
+		case SeverityWarning, SeverityCritical:
+			alert, ok := e.firing[key]
+			if !ok {
+				alert = Alert{Name: result.Name, Account: account, StartsAt: t}
+			}
+			alert.Severity = result.Severity
+			alert.Value = result.Value.Value
+			alert.Summary = alertSummary(result)
+			e.firing[key] = alert
+		case SeverityOK:
+			delete(e.firing, key)
+		}
+	}
+
+	for _, n := range e.notifiers {
+		e.notify(n, account, t)
+	}
+}
+
+// failedDuringWindow records the number of failed API requests of account at
+// t, and returns how many failed during the window. Until the window is
+// covered, the requests are counted since the client was created.
+func (e *Evaluator) failedDuringWindow(account string, failures int, t time.Time) int {
+	counts := e.failures[account]
+	if len(counts) == 0 {
+		counts = []failureCount{{at: t}}
+	}
+	counts = append(counts, failureCount{at: t, count: failures})
+	// Keep the latest count at or before the start of the window as the
+	// base of the others.
+	for len(counts) > 1 && !counts[1].at.After(t.Add(-e.failedWindow)) {
+		counts = counts[1:]
+	}
+	e.failures[account] = counts
+	return failures - counts[0].count
+}
+
+// notify sends the alerts of account which changed since n was last told
+// about them, or all of them to Alertmanager. They are sent again at the
+// next evaluation if it fails.
+func (e *Evaluator) notify(n *notifier, account string, t time.Time) {
+	var alerts []Alert
+	for key, alert := range e.firing {
+		if alert.Account != account {
+			continue
+		}
+		if notified, ok := n.notified[key]; ok && notified.Severity == alert.Severity && n.Type != NotifierAlertmanager {
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	for key, alert := range n.notified {
+		if _, ok := e.firing[key]; ok || alert.Account != account {
+			continue
+		}
+		alert.EndsAt = t
+		if result := e.latest[key]; result.Value.Valid {
+			alert.Value = result.Value.Value
+			alert.Summary = alertSummary(result)
+		}
+		alerts = append(alerts, alert)
+	}
+	if len(alerts) == 0 {
+		return
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Name < alerts[j].Name })
+
+	if err := n.send(alerts, e.interval); err != nil {
+		log.Printf("[alerting] Failed to notify %s: %v", n.Type, err)
+		return
+	}
+	for _, alert := range alerts {
+		if alert.Resolved() {
+			delete(n.notified, alert.key())
+		} else {
+			n.notified[alert.key()] = alert
+		}
+	}
+}
+
+// send posts the alerts in the format of the notifier. Firing alerts are
+// given to Alertmanager an end a few evaluations ahead, so that they resolve
+// by themselves if the exporter stops.
+func (n *notifier) send(alerts []Alert, interval time.Duration) error {
+	target := n.URL
+	var payload any
+	switch n.Type {
+	case NotifierSlack:
+		var lines []string
+		for _, alert := range alerts {
+			lines = append(lines, alertText(alert))
+		}
+		payload = map[string]string{"text": strings.Join(lines, "\n")}
+	case NotifierAlertmanager:
+		target = strings.TrimRight(n.URL, "/") + "/api/v2/alerts"
+		var amAlerts []map[string]any
+		for _, alert := range alerts {
+			labels := map[string]string{
+				"alertname": alertNames[alert.Name],
+				"severity":  strings.ToLower(alert.Severity.String()),
+			}
+			if alert.Account != "" {
+				labels["account"] = alert.Account
+			}
+			endsAt := alert.EndsAt
+			if !alert.Resolved() {
+				endsAt = now().Add(3 * interval)
+			}
+			amAlerts = append(amAlerts, map[string]any{
+				"labels":      labels,
+				"annotations": map[string]string{"summary": alertText(alert)},
+				"startsAt":    alert.StartsAt,
+				"endsAt":      endsAt,
+			})
+		}
+		payload = amAlerts
+	default:
+		var hookAlerts []map[string]any
+		for _, alert := range alerts {
+			hookAlert := map[string]any{
+				"status":    "firing",
+				"name":      alert.Name,
+				"severity":  strings.ToLower(alert.Severity.String()),
+				"value":     alert.Value,
+				"summary":   alert.Summary,
+				"starts_at": alert.StartsAt,
+			}
+			if alert.Account != "" {
+				hookAlert["account"] = alert.Account
+			}
+			if alert.Resolved() {
+				hookAlert["status"] = "resolved"
+				hookAlert["ends_at"] = alert.EndsAt
+			}
+			hookAlerts = append(hookAlerts, hookAlert)
+		}
+		payload = map[string]any{"alerts": hookAlerts}
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(payload); err != nil {
+		return err
+	}
+	resp, err := n.client.Post(target, "application/json", &body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", target, resp.Status)
+	}
+	return nil
+}
+
+// alertSummary describes a result, with the level it breaches if any.
+func alertSummary(result CheckResult) string {
+	value := strconv.FormatFloat(result.Value.Value, 'f', 2, 64) + "%"
+	if !strings.HasSuffix(result.Name, "_percent") {
+		value = strconv.FormatFloat(result.Value.Value, 'f', -1, 64)
+	}
+	if result.Severity != SeverityWarning && result.Severity != SeverityCritical {
+		return result.Name + " " + value
+	}
+	level, op := result.Threshold.Warning, ">"
+	if result.Severity == SeverityCritical {
+		level = result.Threshold.Critical
+	}
+	if result.Below {
+		op = "<"
+	}
+	return fmt.Sprintf("%s %s (%s %s)", result.Name, value, op, strconv.FormatFloat(*level, 'f', -1, 64))
+}
+
+// alertText describes an alert in a line of text.
+func alertText(alert Alert) string {
+	state := "FIRING:" + alert.Severity.String()
+	if alert.Resolved() {
+		state = "RESOLVED"
+	}
+	subject := "SMTP2GO"
+	if alert.Account != "" {
+		subject += " " + alert.Account
+	}
+	return fmt.Sprintf("[%s] %s: %s", state, subject, alert.Summary)
+}
@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+// notification is a request received by a notificationSink.
+type notification struct {
+	path string
+	body string
+}
+
+// notificationSink is a local stand-in for the destinations of
+// notifications, answering with the queued status codes, then 200.
+type notificationSink struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	received []notification
+	statuses []int
+}
+
+func newNotificationSink(t *testing.T, statuses ...int) *notificationSink {
+	sink := &notificationSink{statuses: statuses}
+	sink.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sink.mutex.Lock()
+		defer sink.mutex.Unlock()
+		sink.received = append(sink.received, notification{path: r.URL.Path, body: string(body)})
+		if len(sink.statuses) > 0 {
+			w.WriteHeader(sink.statuses[0])
+			sink.statuses = sink.statuses[1:]
+		}
+	}))
+	t.Cleanup(sink.Close)
+	return sink
+}
+
+// scrape collects the built-in collectors of client, as Prometheus would
+// before an evaluation.
+func scrape(t *testing.T, client *Client) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollectors(client, &Config{}, nil)...)
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// take returns the notifications received since the previous call.
+func (s *notificationSink) take() []notification {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	received := s.received
+	s.received = nil
+	return received
+}
+
+func TestEvaluatorWebhook(t *testing.T) {
+	setNow(t, testNow)
+	server, client := newTestServer(t)
+	sink := newNotificationSink(t)
+	evaluator := NewEvaluator(AlertingConfig{Notifiers: []NotifierConfig{{Type: NotifierWebhook, URL: sink.URL}}}, DefaultThresholds())
+
+	// Nothing was scraped yet: nothing is known, nothing is fetched.
+	evaluator.Evaluate("", client)
+	if received := sink.take(); len(received) != 0 || len(server.Requests()) != 0 {
+		t.Fatalf("got notifications %v and %d requests before a scrape", received, len(server.Requests()))
+	}
+
+	scrape(t, client)
+	requests := len(server.Requests())
+	evaluator.Evaluate("", client)
+	if got := len(server.Requests()); got != requests {
+		t.Errorf("evaluation made %d requests", got-requests)
+	}
+	received := sink.take()
+	if len(received) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(received))
+	}
+	var payload struct {
+		Alerts []map[string]any `json:"alerts"`
+	}
+	if err := json.Unmarshal([]byte(received[0].body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Alerts) != 1 {
+		t.Fatalf("got alerts %v", payload.Alerts)
+	}
+	alert := payload.Alerts[0]
+	for key, want := range map[string]any{
+		"status":    "firing",
+		"name":      "spam_percent",
+		"severity":  "critical",
+		"value":     0.5,
+		"summary":   "spam_percent 0.50% (> 0.3)",
+		"starts_at": "2025-01-23T12:00:00Z",
+	} {
+		if alert[key] != want {
+			t.Errorf("%s = %v, want %v", key, alert[key], want)
+		}
+	}
+	if _, ok := alert["account"]; ok {
+		t.Errorf("unexpected account %v", alert["account"])
+	}
+
+	// Nothing changed: nothing is notified again.
+	evaluator.Evaluate("", client)
+	if received := sink.take(); len(received) != 0 {
+		t.Errorf("got duplicate notifications %v", received)
+	}
+
+	server.SetBody("/stats/email_spam", `{"data":{"emails":415,"rejects":0,"spams":0,"spam_percent":"0"}}`)
+	scrape(t, client)
+	evaluator.Evaluate("", client)
+	received = sink.take()
+	if len(received) != 1 || !strings.Contains(received[0].body, `"status":"resolved"`) || !strings.Contains(received[0].body, `"summary":"spam_percent 0.00%"`) {
+		t.Errorf("got %v, want a resolve notification", received)
+	}
+}
+
+func TestEvaluatorOutdatedStatistics(t *testing.T) {
+	_, client := newTestServer(t)
+	sink := newNotificationSink(t)
+	evaluator := NewEvaluator(AlertingConfig{
+		Interval:  time.Minute,
+		Notifiers: []NotifierConfig{{Type: NotifierWebhook, URL: sink.URL}},
+	}, DefaultThresholds())
+
+	// The last scrape is older than three intervals: the spam percentage is
+	// not evaluated.
+	scrape(t, client)
+	client.mutex.Lock()
+	for key, resp := range client.cache {
+		resp.fetchedAt = resp.fetchedAt.Add(-4 * time.Minute)
+		client.cache[key] = resp
+	}
+	client.mutex.Unlock()
+	evaluator.Evaluate("", client)
+	if received := sink.take(); len(received) != 0 {
+		t.Errorf("got notifications %v for outdated statistics", received)
+	}
+
+	// The minimum refresh interval of a collector extends the age allowed.
+	client.opts.MinIntervals = map[string]time.Duration{"email_spam": 5 * time.Minute}
+	evaluator.Evaluate("", client)
+	if received := sink.take(); len(received) != 1 || !strings.Contains(received[0].body, `"name":"spam_percent"`) {
+		t.Errorf("got %v, want a spam_percent notification", received)
+	}
+}
+
+func TestEvaluatorSlack(t *testing.T) {
+	_, client := newTestServer(t)
+	sink := newNotificationSink(t)
+	level := func(v float64) *float64 { return &v }
+	thresholds := Thresholds{BouncePercent: Threshold{Warning: level(1)}}.WithDefaults()
+	evaluator := NewEvaluator(AlertingConfig{Notifiers: []NotifierConfig{{Type: NotifierSlack, URL: sink.URL}}}, thresholds)
+
+	scrape(t, client)
+	evaluator.Evaluate("main", client)
+	received := sink.take()
+	if len(received) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(received))
+	}
+	var payload struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(received[0].body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := "[FIRING:WARNING] SMTP2GO main: bounce_percent 1.25% (> 1)\n[FIRING:CRITICAL] SMTP2GO main: spam_percent 0.50% (> 0.3)"
+	if payload.Text != want {
+		t.Errorf("got text\n%s\nwant\n%s", payload.Text, want)
+	}
+}
+
+func TestEvaluatorAlertmanager(t *testing.T) {
+	setNow(t, testNow)
+	_, client := newTestServer(t)
+	sink := newNotificationSink(t)
+	evaluator := NewEvaluator(AlertingConfig{Notifiers: []NotifierConfig{{Type: NotifierAlertmanager, URL: sink.URL + "/"}}}, DefaultThresholds())
+
+	// Alertmanager is told about firing alerts at every evaluation.
+	scrape(t, client)
+	for i := 0; i < 2; i++ {
+		evaluator.Evaluate("main", client)
+		received := sink.take()
+		if len(received) != 1 || received[0].path != "/api/v2/alerts" {
+			t.Fatalf("evaluation %d: got %v", i, received)
+		}
+		var alerts []struct {
+			Labels   map[string]string `json:"labels"`
+			StartsAt string            `json:"startsAt"`
+			EndsAt   string            `json:"endsAt"`
+		}
+		if err := json.Unmarshal([]byte(received[0].body), &alerts); err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 1 || alerts[0].Labels["alertname"] != "SMTP2GOSpamRateHigh" || alerts[0].Labels["severity"] != "critical" || alerts[0].Labels["account"] != "main" {
+			t.Errorf("evaluation %d: got %+v", i, alerts)
+		}
+		if alerts[0].EndsAt != "2025-01-23T12:03:00Z" {
+			t.Errorf("endsAt = %s, want three intervals ahead", alerts[0].EndsAt)
+		}
+	}
+}
+
+func TestEvaluatorFailedCalls(t *testing.T) {
+	setNow(t, testNow)
+	server, client := newTestServer(t)
+	sink := newNotificationSink(t, http.StatusInternalServerError)
+	level := func(v float64) *float64 { return &v }
+	evaluator := NewEvaluator(AlertingConfig{
+		FailedAPICalls:       Threshold{Warning: level(1), Critical: level(5)},
+		FailedAPICallsWindow: 10 * time.Minute,
+		Notifiers:            []NotifierConfig{{Type: NotifierWebhook, URL: sink.URL}},
+	}, DefaultThresholds())
+
+	server.SetResponse("/stats/email_bounces", smtp2gotest.Error(http.StatusBadRequest))
+	scrape(t, client)
+	// A single failed request stays below the warning level.
+	evaluator.Evaluate("", client)
+	if received := sink.take(); len(received) != 1 || strings.Contains(received[0].body, "failed_api_calls") {
+		t.Fatalf("got %v, want a notification without failed_api_calls", received)
+	}
+
+	setNow(t, testNow.Add(time.Minute))
+	scrape(t, client)
+	evaluator.Evaluate("", client)
+	received := sink.take()
+	if len(received) != 1 || !strings.Contains(received[0].body, `"summary":"failed_api_calls 2 (> 1)"`) {
+		t.Errorf("got %v, want a failed_api_calls warning", received)
+	}
+
+	// The failures are still counted within the window, without flapping.
+	server.SetBody("/stats/email_bounces", smtp2gotest.EmailBouncesBody)
+	setNow(t, testNow.Add(5*time.Minute))
+	scrape(t, client)
+	evaluator.Evaluate("", client)
+	if received := sink.take(); len(received) != 0 {
+		t.Errorf("got %v, want no notification within the window", received)
+	}
+
+	setNow(t, testNow.Add(12*time.Minute))
+	scrape(t, client)
+	evaluator.Evaluate("", client)
+	received = sink.take()
+	if len(received) != 1 || !strings.Contains(received[0].body, `"status":"resolved"`) {
+		t.Errorf("got %v, want a resolve notification", received)
+	}
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned when a call is short-circuited and no previous
+// response is available to serve instead.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states, as exported by smtp2go_api_circuit_state.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// breaker is the circuit breaker of a single endpoint. After threshold
+// consecutive failures it opens and rejects calls until cooldown has elapsed,
+// then lets a single trial call through: its success closes the circuit, its
+// failure opens it again.
+type breaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may be made now.
+func (b *breaker) allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.threshold <= 0 {
+		return true
+	}
+	switch b.state {
+	case circuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// A trial call is already in flight.
+		return false
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of an allowed call.
+func (b *breaker) record(success bool, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if success {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = circuitOpen
+		b.openedAt = now
+	}
+}
+
+// release gives back an allowed call that was never made, leaving the
+// breaker as it was before allow. A half-open breaker returns to open, so the
+// next call after the cooldown becomes the trial.
+func (b *breaker) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+// current returns the state of the breaker.
+func (b *breaker) current() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// yamlErrorLine matches the line number in the errors of the YAML decoder.
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// CheckConfig reads the configuration file at path and returns all its
+// problems, sorted by line. When the configuration is valid and test is
+// set, test is called on each account to check its credentials. The error is
+// only set when the file cannot be read.
+func CheckConfig(path string, test func(cfg *Config, account AccountConfig) error) ([]*ConfigError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return yamlProblems(err), nil
+	}
+
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	problems := []*ConfigError{}
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		problems = append(problems, yamlProblems(err)...)
+	}
+	for _, problem := range cfg.Problems() {
+		problem.Line = locate(&root, problem.Path)
+		problems = append(problems, problem)
+	}
+
+	for i, account := range cfg.Accounts {
+		path := fmt.Sprintf("accounts[%d]", i)
+		if account.APIKeyFile == "" {
+			continue
+		}
+		if _, err := account.Key(); err != nil {
+			problems = append(problems, &ConfigError{Path: path + ".api_key_file", Line: locate(&root, path+".api_key_file"), Err: err})
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	if len(problems) > 0 || test == nil {
+		return problems, nil
+	}
+
+	for i, account := range cfg.Accounts {
+		path := fmt.Sprintf("accounts[%d]", i)
+		if err := test(&cfg, account); err != nil {
+			problems = append(problems, &ConfigError{
+				Path: path,
+				Line: locate(&root, path),
+				Err:  fmt.Errorf("account %s: credential test failed: %w", account.Name, err),
+			})
+		}
+	}
+	return problems, nil
+}
+
+// yamlProblems splits an error of the YAML decoder into located problems.
+func yamlProblems(err error) []*ConfigError {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	var problems []*ConfigError
+	for _, message := range messages {
+		problem := &ConfigError{Err: errors.New(message)}
+		if m := yamlErrorLine.FindStringSubmatch(message); m != nil {
+			problem.Line, _ = strconv.Atoi(m[1])
+			problem.Err = errors.New(m[2])
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// locate returns the line of the setting at path in the YAML tree, or of its
+// closest existing parent.
+func locate(root *yaml.Node, path string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+
+	for _, part := range strings.Split(strings.ReplaceAll(path, "[", ".["), ".") {
+		if part == "" {
+			continue
+		}
+		var next *yaml.Node
+		if index, ok := strings.CutPrefix(part, "["); ok {
+			i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err == nil && node.Kind == yaml.SequenceNode && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		} else if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == part {
+					next = node.Content[i+1]
+					line = node.Content[i].Line
+					break
+				}
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	path := writeConfig(t, `accounts:
+  - name: main
+    api_key: one
+  - name: main
+    api_key: two
+collectors:
+  email_cycle:
+    min_interval: soon
+  bogus: {}
+thresholds:
+  spam_percent: {warning: 2, critical: 1}
+`)
+
+	problems, err := CheckConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, problem := range problems {
+		got = append(got, fmt.Sprintf("%d: %v", problem.Line, problem))
+	}
+	want := []string{
+		"4: account main: duplicate name",
+		"8: cannot unmarshal !!str `soon` into time.Duration",
+		"9: collectors: unknown collector \"bogus\"",
+		"10: thresholds: spam_percent: critical level must not be below the warning one",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckConfigSyntaxError(t *testing.T) {
+	problems, err := CheckConfig(writeConfig(t, "accounts:\n  - name: [\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Line == 0 {
+		t.Errorf("got problems %v, want one located syntax error", problems)
+	}
+}
+
+func TestCheckConfigCredentials(t *testing.T) {
+	path := writeConfig(t, "accounts:\n  - name: good\n    api_key: one\n  - name: bad\n    api_key: two\n")
+
+	problems, err := CheckConfig(path, func(cfg *Config, account AccountConfig) error {
+		if account.APIKey != "one" {
+			return errors.New("unauthorized")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Line != 4 || !strings.Contains(problems[0].Error(), "account bad: credential test failed") {
+		t.Errorf("unexpected problems %v", problems)
+	}
+}
@@ -0,0 +1,592 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// maxAttempts bounds the number of requests made for a single fetch.
+	maxAttempts = 5
+	// baseBackoff is the wait before the first retry, doubled on each retry.
+	baseBackoff = 500 * time.Millisecond
+	// maxBackoff caps the wait between two attempts.
+	maxBackoff = 30 * time.Second
+)
+
+// errScrapeDeadline is returned when the scrape a call is made for has run
+// out of time and no previous response is available to serve instead.
+var errScrapeDeadline = errors.New("scrape deadline exceeded")
+
+// The metrics of the client.
+var (
+	requestsMetric = Metric{
+		Name:   "smtp2go_api_requests_total",
+		Help:   "Number of requests made to the SMTP2GO API",
+		Labels: []string{"endpoint", "code"},
+	}
+	retriesMetric = Metric{
+		Name: "smtp2go_api_retries_total",
+		Help: "Number of requests to the SMTP2GO API that were retried",
+	}
+	budgetConsumedMetric = Metric{
+		Name: "smtp2go_api_budget_consumed_total",
+		Help: "Number of requests taken from the request budget",
+	}
+	skippedMetric = Metric{
+		Name:   "smtp2go_api_refreshes_skipped_total",
+		Help:   "Number of scrapes served from the cache instead of calling the API",
+		Labels: []string{"collector", "reason"},
+	}
+	circuitStateMetric = Metric{
+		Name:   "smtp2go_api_circuit_state",
+		Help:   "State of the circuit breaker of the endpoint (0: closed, 1: open, 2: half-open)",
+		Labels: []string{"endpoint"},
+	}
+	staleMetric = Metric{
+		Name:   "smtp2go_api_response_stale",
+		Help:   "Whether the last response served for the endpoint is an outdated cached one",
+		Labels: []string{"endpoint"},
+	}
+	budgetTokensMetric = Metric{
+		Name: "smtp2go_api_budget_tokens",
+		Help: "Number of requests currently available in the request budget",
+	}
+)
+
+// ClientOptions configures a Client.
+type ClientOptions struct {
+	APIURL string
+	APIKey string
+	Debug  bool
+	// Timeout bounds every fetch including its retries. The fetches of a
+	// scrape are also bounded together by its deadline, see StartScrape.
+	Timeout time.Duration
+	// BreakerThreshold is the number of consecutive failures after which calls
+	// to an endpoint are short-circuited. Zero disables the circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit stays open before a trial call.
+	BreakerCooldown time.Duration
+	// RequestsPerSecond is the rate at which the request budget is refilled,
+	// shared by all collectors. Zero disables the budget.
+	RequestsPerSecond float64
+	// Burst is the number of requests the budget can hold.
+	Burst int
+	// MinIntervals holds, by collector name, the minimum time between two
+	// refreshes of its data. Scrapes in between are served from the cache.
+	MinIntervals map[string]time.Duration
+	// RecordDir, when set, is a directory where every API response is saved.
+	RecordDir string
+	// ReplayDir, when set, is a directory of recorded responses served
+	// instead of calling the API.
+	ReplayDir string
+	// StateDir, when set, is a directory where collectors keep what they
+	// learn across restarts, such as the usage of previous cycles.
+	StateDir string
+}
+
+// cachedResponse is the last successful response of an endpoint.
+type cachedResponse struct {
+	body      []byte
+	fetchedAt time.Time
+}
+
+// Client performs requests against the SMTP2GO API. Rate limiting (HTTP 429)
+// and transient server errors are retried with a jittered exponential
+// backoff, as long as the retry fits within the client timeout. Endpoints
+// that keep failing are short-circuited by a circuit breaker, serving their
+// last known response instead, and so are calls exceeding the request
+// budget or arriving before the minimum refresh interval of a collector.
+type Client struct {
+	opts       ClientOptions
+	httpClient *http.Client
+
+	mutex    sync.Mutex
+	breakers map[string]*breaker
+	cache    map[string]cachedResponse
+	stale    map[string]bool
+	budget   *tokenBucket
+	replayer *replayer
+	// clocks holds the time of the responses being replayed, by endpoint.
+	clocks map[string]time.Time
+	// failures counts the requests to the API which failed, as counted by
+	// requests with a code other than 2xx.
+	failures int
+	// scrapes holds the deadlines of the scrapes in progress.
+	scrapes    map[int]time.Time
+	nextScrape int
+
+	requests       *prometheus.CounterVec
+	retries        prometheus.Counter
+	budgetConsumed prometheus.Counter
+	skipped        *prometheus.CounterVec
+	circuitState   *prometheus.Desc
+	staleDesc      *prometheus.Desc
+	budgetTokens   *prometheus.Desc
+}
+
+// NewClient returns a client configured with opts.
+func NewClient(opts ClientOptions) *Client {
+	var budget *tokenBucket
+	var replay *replayer
+	if opts.ReplayDir != "" {
+		// Replaying does not use any quota.
+		replay = newReplayer(opts.ReplayDir)
+	} else if opts.RequestsPerSecond > 0 {
+		budget = newTokenBucket(opts.RequestsPerSecond, max(opts.Burst, 1), time.Now())
+	}
+
+	return &Client{
+		opts:       opts,
+		httpClient: &http.Client{},
+		breakers:   map[string]*breaker{},
+		cache:      map[string]cachedResponse{},
+		stale:      map[string]bool{},
+		budget:     budget,
+		replayer:   replay,
+		clocks:     map[string]time.Time{},
+		scrapes:    map[int]time.Time{},
+
+		requests:       prometheus.NewCounterVec(requestsMetric.counterOpts(), requestsMetric.Labels),
+		retries:        prometheus.NewCounter(retriesMetric.counterOpts()),
+		budgetConsumed: prometheus.NewCounter(budgetConsumedMetric.counterOpts()),
+		skipped:        prometheus.NewCounterVec(skippedMetric.counterOpts(), skippedMetric.Labels),
+		circuitState:   circuitStateMetric.desc(nil),
+		staleDesc:      staleMetric.desc(nil),
+		budgetTokens:   budgetTokensMetric.desc(nil),
+	}
+}
+
+// metrics lists the metrics of the client, as described by Describe.
+func (c *Client) metrics() []Metric {
+	metrics := []Metric{requestsMetric, retriesMetric, budgetConsumedMetric, skippedMetric, circuitStateMetric, staleMetric}
+	if c.budget != nil {
+		metrics = append(metrics, budgetTokensMetric)
+	}
+	return metrics
+}
+
+func (c *Client) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.retries.Describe(ch)
+	c.budgetConsumed.Describe(ch)
+	c.skipped.Describe(ch)
+	ch <- c.circuitState
+	ch <- c.staleDesc
+	if c.budget != nil {
+		ch <- c.budgetTokens
+	}
+}
+
+func (c *Client) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.retries.Collect(ch)
+	c.budgetConsumed.Collect(ch)
+	c.skipped.Collect(ch)
+	if c.budget != nil {
+		ch <- prometheus.MustNewConstMetric(c.budgetTokens, prometheus.GaugeValue, c.budget.available(time.Now()))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for endpoint, b := range c.breakers {
+		ch <- prometheus.MustNewConstMetric(c.circuitState, prometheus.GaugeValue, float64(b.current()), endpoint)
+	}
+	for endpoint, stale := range c.stale {
+		value := 0.0
+		if stale {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.staleDesc, prometheus.GaugeValue, value, endpoint)
+	}
+}
+
+// statusError is returned for responses with an unexpected HTTP status.
+type statusError struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d %s", e.code, http.StatusText(e.code))
+}
+
+// retryable reports whether a request failing with the given status may
+// succeed when retried.
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Fetch posts to the given endpoint on behalf of the named collector and
+// returns the response body. Within the minimum refresh interval of the
+// collector, the last response is returned without calling the API. While the
+// circuit of the endpoint is open, the request budget is exhausted or the
+// scrape deadline has passed, the last successful response is returned
+// instead and flagged as stale.
+func (c *Client) Fetch(endpoint, collector string) ([]byte, error) {
+	return c.FetchParams(endpoint, collector, nil)
+}
+
+// FetchParams is like Fetch, sending params along with the API key. Responses
+// are cached per endpoint and parameters.
+func (c *Client) FetchParams(endpoint, collector string, params map[string]any) ([]byte, error) {
+	key := cacheKey(endpoint, params)
+	if body, ok := c.fresh(key, collector); ok {
+		c.skipped.WithLabelValues(collector, "min_interval").Inc()
+		return body, nil
+	}
+
+	if deadline, ok := c.scrapeDeadline(); ok && !time.Now().Before(deadline) {
+		log.Printf("[%s] Scrape deadline passed, serving last known response", collector)
+		c.skipped.WithLabelValues(collector, "deadline").Inc()
+		return c.cached(endpoint, key, errScrapeDeadline)
+	}
+
+	b := c.breaker(endpoint)
+	if !b.allow(time.Now()) {
+		if c.opts.Debug {
+			log.Printf("[%s] Circuit open, serving last known response", collector)
+		}
+		c.skipped.WithLabelValues(collector, "circuit_open").Inc()
+		return c.cached(endpoint, key, errCircuitOpen)
+	}
+
+	body, err := c.fetch(endpoint, params, collector)
+	if err == errBudgetExhausted {
+		// Nothing was sent: the breaker has no outcome to learn from.
+		b.release()
+		log.Printf("[%s] Request budget exhausted, serving last known response", collector)
+		c.skipped.WithLabelValues(collector, "budget").Inc()
+		return c.cached(endpoint, key, err)
+	}
+	if statusErr, ok := err.(*statusError); ok && !retryable(statusErr.code) {
+		// The API answered: the request itself is at fault, not the service.
+		b.record(true, time.Now())
+		return nil, err
+	}
+	b.record(err == nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.cache[key] = cachedResponse{body: body, fetchedAt: time.Now()}
+	c.stale[endpoint] = false
+	c.mutex.Unlock()
+	return body, nil
+}
+
+// cacheKey identifies the responses of an endpoint to the given parameters.
+func cacheKey(endpoint string, params map[string]any) string {
+	if len(params) == 0 {
+		return endpoint
+	}
+	// Maps are encoded with sorted keys.
+	encoded, _ := json.Marshal(params)
+	return endpoint + string(encoded)
+}
+
+// fresh returns the cached response for key if it is recent enough for the
+// minimum refresh interval of the collector.
+func (c *Client) fresh(key, collector string) ([]byte, bool) {
+	interval := c.opts.MinIntervals[collector]
+	if interval <= 0 {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	resp, ok := c.cache[key]
+	if !ok || time.Since(resp.fetchedAt) >= interval {
+		return nil, false
+	}
+	return resp.body, true
+}
+
+// breaker returns the circuit breaker of the endpoint.
+func (c *Client) breaker(endpoint string) *breaker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	b, ok := c.breakers[endpoint]
+	if !ok {
+		b = newBreaker(c.opts.BreakerThreshold, c.opts.BreakerCooldown)
+		c.breakers[endpoint] = b
+	}
+	return b
+}
+
+// Failures returns the number of requests to the API which failed since the
+// client was created, retries included, like smtp2go_api_requests_total with
+// a code other than 2xx.
+func (c *Client) Failures() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.failures
+}
+
+// Cached returns the last successful response of the endpoint to a request
+// without parameters and the time it was fetched at, without calling the API.
+func (c *Client) Cached(endpoint string) ([]byte, time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	resp, ok := c.cache[cacheKey(endpoint, nil)]
+	return resp.body, resp.fetchedAt, ok
+}
+
+// cached returns the last successful response for key and flags the endpoint
+// as stale, or err if there is none.
+func (c *Client) cached(endpoint, key string, err error) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	resp, ok := c.cache[key]
+	if !ok {
+		return nil, err
+	}
+	c.stale[endpoint] = true
+	return resp.body, nil
+}
+
+// StartScrape bounds every call made until the returned function is called,
+// retries included, by deadline on top of the timeout of each call. Once it
+// has passed, the last known responses are served instead. When scrapes
+// overlap, the latest deadline applies.
+func (c *Client) StartScrape(deadline time.Time) func() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id := c.nextScrape
+	c.nextScrape++
+	c.scrapes[id] = deadline
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		delete(c.scrapes, id)
+	}
+}
+
+// scrapeDeadline returns the deadline of the scrapes in progress, if any.
+func (c *Client) scrapeDeadline() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var latest time.Time
+	for _, deadline := range c.scrapes {
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	return latest, len(c.scrapes) > 0
+}
+
+// fetch posts to the endpoint, retrying transient failures as long as the
+// request budget and the deadlines allow it.
+func (c *Client) fetch(endpoint string, params map[string]any, logPrefix string) ([]byte, error) {
+	ctx := context.Background()
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	if deadline, ok := c.scrapeDeadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if c.budget != nil {
+			if !c.budget.take(time.Now()) {
+				if lastErr != nil {
+					log.Printf("[%s] HTTP request failed, no budget left to retry: %v", logPrefix, lastErr)
+					return nil, lastErr
+				}
+				return nil, errBudgetExhausted
+			}
+			c.budgetConsumed.Inc()
+		}
+
+		body, err := c.post(ctx, endpoint, params, logPrefix)
+		if err == nil {
+			return body, nil
+		}
+		var replayErr *replayError
+		if errors.As(err, &replayErr) {
+			log.Printf("[%s] %v", logPrefix, err)
+			return nil, err
+		}
+		lastErr = err
+
+		wait := backoff(attempt)
+		if statusErr, ok := err.(*statusError); ok {
+			if !retryable(statusErr.code) {
+				log.Printf("[%s] HTTP request failed: %v", logPrefix, err)
+				return nil, err
+			}
+			if statusErr.retryAfter > 0 {
+				wait = statusErr.retryAfter
+			}
+		}
+		if ctx.Err() != nil || attempt+1 >= maxAttempts {
+			log.Printf("[%s] HTTP request failed: %v", logPrefix, err)
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			log.Printf("[%s] HTTP request failed, no time left to retry: %v", logPrefix, err)
+			return nil, err
+		}
+
+		if c.opts.Debug {
+			log.Printf("[%s] Retrying in %s after error: %v", logPrefix, wait, err)
+		}
+		c.retries.Inc()
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// clock returns the time at which the response of the endpoint is to be
+// interpreted: the time it was recorded at when replaying, now otherwise.
+func (c *Client) clock(endpoint string) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if t, ok := c.clocks[endpoint]; ok {
+		return t
+	}
+	return now()
+}
+
+// post makes a single request to the endpoint, or replays the next recorded
+// response.
+func (c *Client) post(ctx context.Context, endpoint string, params map[string]any, logPrefix string) ([]byte, error) {
+	var (
+		status     int
+		retryAfter string
+		body       []byte
+	)
+	if c.replayer != nil {
+		rec, err := c.replayer.replay(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		status, retryAfter, body = rec.Status, rec.RetryAfter, rec.body()
+		c.mutex.Lock()
+		c.clocks[endpoint] = rec.Time
+		c.mutex.Unlock()
+	} else {
+		request := map[string]any{"api_key": c.opts.APIKey}
+		for name, value := range params {
+			request[name] = value
+		}
+		reqBody, _ := json.Marshal(request)
+		req, err := http.NewRequestWithContext(ctx, "POST", c.opts.APIURL+endpoint, bytes.NewBuffer(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			c.countRequest(endpoint, "error")
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		status, retryAfter = resp.StatusCode, resp.Header.Get("Retry-After")
+		if c.opts.RecordDir != "" {
+			c.record(endpoint, params, status, retryAfter, body)
+		}
+	}
+
+	c.countRequest(endpoint, strconv.Itoa(status))
+	if c.opts.Debug {
+		log.Printf("[%s] Raw response: %s\n", logPrefix, string(body))
+	}
+
+	if status < 200 || status > 299 {
+		return nil, &statusError{
+			code:       status,
+			retryAfter: parseRetryAfter(retryAfter),
+		}
+	}
+	return body, nil
+}
+
+// countRequest counts a request to the endpoint answered with the given
+// code, or "error" when no answer came.
+func (c *Client) countRequest(endpoint, code string) {
+	c.requests.WithLabelValues(endpoint, code).Inc()
+	if code[0] != '2' {
+		c.mutex.Lock()
+		c.failures++
+		c.mutex.Unlock()
+	}
+}
+
+// backoff returns the jittered wait before the retry following the given
+// attempt, between half and all of the exponential backoff.
+func backoff(attempt int) time.Duration {
+	wait := maxBackoff
+	if attempt < 16 {
+		wait = min(baseBackoff<<attempt, maxBackoff)
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// parseRetryAfter decodes a Retry-After header, given either in seconds or as
+// an HTTP date. It returns zero when the header is absent or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestClientRetriesRateLimit(t *testing.T) {
+	server, client := newTestServer(t)
+	limited := smtp2gotest.Error(http.StatusTooManyRequests)
+	limited.Header = http.Header{"Retry-After": {"1"}}
+	server.Enqueue("/stats/email_cycle", limited, smtp2gotest.Error(http.StatusServiceUnavailable))
+
+	start := time.Now()
+	body, err := client.Fetch("/stats/email_cycle", "email_cycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != smtp2gotest.EmailCycleBody {
+		t.Errorf("unexpected body %s", body)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retry-After not honoured, retried after %s", elapsed)
+	}
+
+	values := collectValues(t, client)
+	for key, want := range map[string]float64{
+		`smtp2go_api_requests_total{code="429",endpoint="/stats/email_cycle"}`: 1,
+		`smtp2go_api_requests_total{code="503",endpoint="/stats/email_cycle"}`: 1,
+		`smtp2go_api_requests_total{code="200",endpoint="/stats/email_cycle"}`: 1,
+		"smtp2go_api_retries_total": 2,
+	} {
+		if got := values[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetResponse("/stats/email_cycle", smtp2gotest.Error(http.StatusBadRequest))
+
+	if _, err := client.Fetch("/stats/email_cycle", "email_cycle"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := server.RequestCount("/stats/email_cycle"); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestClientGivesUpAtDeadline(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := NewClient(ClientOptions{APIURL: server.URL, APIKey: "test-key", Timeout: 300 * time.Millisecond})
+	limited := smtp2gotest.Error(http.StatusTooManyRequests)
+	limited.Header = http.Header{"Retry-After": {"60"}}
+	server.SetResponse("/stats/email_cycle", limited)
+
+	start := time.Now()
+	if _, err := client.Fetch("/stats/email_cycle", "email_cycle"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fetch took %s, beyond its deadline", elapsed)
+	}
+	if got := server.RequestCount("/stats/email_cycle"); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := NewClient(ClientOptions{
+		APIURL:           server.URL,
+		APIKey:           "test-key",
+		Timeout:          100 * time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+
+	if _, err := client.Fetch("/stats/email_cycle", "email_cycle"); err != nil {
+		t.Fatal(err)
+	}
+	server.SetResponse("/stats/email_cycle", smtp2gotest.Error(http.StatusBadGateway))
+	for range 2 {
+		if _, err := client.Fetch("/stats/email_cycle", "email_cycle"); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	requests := server.RequestCount("/stats/email_cycle")
+
+	body, err := client.Fetch("/stats/email_cycle", "email_cycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != smtp2gotest.EmailCycleBody {
+		t.Errorf("expected the last known response, got %s", body)
+	}
+	if got := server.RequestCount("/stats/email_cycle"); got != requests {
+		t.Errorf("open circuit let %d requests through", got-requests)
+	}
+
+	values := collectValues(t, client)
+	for key, want := range map[string]float64{
+		`smtp2go_api_circuit_state{endpoint="/stats/email_cycle"}`:                           circuitOpen,
+		`smtp2go_api_response_stale{endpoint="/stats/email_cycle"}`:                          1,
+		`smtp2go_api_refreshes_skipped_total{collector="email_cycle",reason="circuit_open"}`: 1,
+	} {
+		if got := values[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	start := time.Now()
+	b := newBreaker(1, time.Minute)
+	b.record(false, start)
+	if b.allow(start.Add(time.Second)) {
+		t.Fatal("open breaker allowed a call")
+	}
+	if !b.allow(start.Add(2 * time.Minute)) {
+		t.Fatal("breaker did not allow a trial call after the cooldown")
+	}
+	if b.allow(start.Add(2 * time.Minute)) {
+		t.Fatal("half-open breaker allowed a second call")
+	}
+	b.record(true, start.Add(2*time.Minute))
+	if b.current() != circuitClosed || !b.allow(start.Add(2*time.Minute)) {
+		t.Fatal("successful trial did not close the breaker")
+	}
+}
+
+func TestClientBudgetHalfOpen(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := NewClient(ClientOptions{
+		APIURL:            server.URL,
+		APIKey:            "test-key",
+		Timeout:           time.Second,
+		BreakerThreshold:  1,
+		BreakerCooldown:   time.Minute,
+		RequestsPerSecond: 1.0 / 3600,
+		Burst:             1,
+	})
+	client.budget.take(time.Now())
+	b := client.breaker("/stats/email_cycle")
+	b.record(false, time.Now().Add(-2*time.Minute))
+
+	if _, err := client.Fetch("/stats/email_cycle", "email_cycle"); err != errBudgetExhausted {
+		t.Errorf("got error %v, want %v", err, errBudgetExhausted)
+	}
+	if got := b.current(); got != circuitOpen {
+		t.Errorf("breaker state = %d, want %d", got, circuitOpen)
+	}
+	if !b.allow(time.Now()) {
+		t.Error("breaker did not allow a trial call once the budget allows it")
+	}
+	if got := len(server.Requests()); got != 0 {
+		t.Errorf("got %d requests, want 0", got)
+	}
+}
+
+func TestClientBudget(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := NewClient(ClientOptions{
+		APIURL:            server.URL,
+		APIKey:            "test-key",
+		Timeout:           time.Second,
+		RequestsPerSecond: 1.0 / 3600,
+		Burst:             2,
+	})
+
+	for _, path := range []string{"/stats/email_cycle", "/stats/email_spam"} {
+		if _, err := client.Fetch(path, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body, err := client.Fetch("/stats/email_cycle", "email_cycle")
+	if err != nil || string(body) != smtp2gotest.EmailCycleBody {
+		t.Errorf("expected the last known response, got %s, %v", body, err)
+	}
+	if _, err := client.Fetch("/stats/email_bounces", "email_bounces"); err != errBudgetExhausted {
+		t.Errorf("got error %v, want %v", err, errBudgetExhausted)
+	}
+	if got := len(server.Requests()); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+
+	values := collectValues(t, client)
+	for key, want := range map[string]float64{
+		"smtp2go_api_budget_consumed_total":                                            2,
+		`smtp2go_api_refreshes_skipped_total{collector="email_cycle",reason="budget"}`: 1,
+	} {
+		if got := values[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if got := values["smtp2go_api_budget_tokens"]; got >= 1 {
+		t.Errorf("budget tokens = %v, want less than 1", got)
+	}
+}
+
+func TestClientScrapeDeadline(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := NewClient(ClientOptions{
+		APIURL:  server.URL,
+		APIKey:  "test-key",
+		Timeout: time.Minute,
+	})
+	if _, err := client.Fetch("/stats/email_cycle", "email_cycle"); err != nil {
+		t.Fatal(err)
+	}
+
+	end := client.StartScrape(time.Now().Add(-time.Second))
+	body, err := client.Fetch("/stats/email_cycle", "email_cycle")
+	if err != nil || string(body) != smtp2gotest.EmailCycleBody {
+		t.Errorf("expected the last known response, got %s, %v", body, err)
+	}
+	if _, err := client.Fetch("/stats/email_spam", "email_spam"); err != errScrapeDeadline {
+		t.Errorf("got error %v, want %v", err, errScrapeDeadline)
+	}
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+	end()
+	if _, err := client.Fetch("/stats/email_spam", "email_spam"); err != nil {
+		t.Errorf("scrape deadline still applied after the scrape: %v", err)
+	}
+
+	values := collectValues(t, client)
+	if got := values[`smtp2go_api_refreshes_skipped_total{collector="email_cycle",reason="deadline"}`]; got != 1 {
+		t.Errorf("skipped = %v, want 1", got)
+	}
+}
+
+func TestClientMinInterval(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := NewClient(ClientOptions{
+		APIURL:       server.URL,
+		APIKey:       "test-key",
+		MinIntervals: map[string]time.Duration{"email_cycle": time.Hour},
+	})
+
+	for range 3 {
+		if _, err := client.Fetch("/stats/email_cycle", "email_cycle"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Fetch("/stats/email_spam", "email_spam"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := server.RequestCount("/stats/email_cycle"); got != 1 {
+		t.Errorf("got %d email_cycle requests, want 1", got)
+	}
+	if got := server.RequestCount("/stats/email_spam"); got != 3 {
+		t.Errorf("got %d email_spam requests, want 3", got)
+	}
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewCollectors returns the collectors enabled by cfg, querying the API
+// through client: the built-in ones followed by those of custom endpoints.
+// Email addresses are exported through pseudonymizer if not nil.
+func NewCollectors(client *Client, cfg *Config, pseudonymizer *Pseudonymizer) []prometheus.Collector {
+	var collectors []prometheus.Collector
+	add := func(name string, collector prometheus.Collector) {
+		if cfg.CollectorEnabled(name) {
+			collectors = append(collectors, collector)
+		}
+	}
+
+	add("email_cycle", NewEmailCycleCollector(client))
+	add("email_bounces", NewEmailBouncesCollector(client))
+	add("email_history", NewEmailHistoryCollector(client, cfg.EmailHistory, pseudonymizer))
+	add("email_spam", NewEmailSpamCollector(client))
+	add("email_unsubs", NewEmailUnsubsCollector(client))
+	for _, endpoint := range cfg.Endpoints {
+		add(endpoint.Name, NewStatsCollector(endpoint, client))
+	}
+	return collectors
+}
+
+// CollectorEnabled reports whether the named collector is enabled.
+func (c *Config) CollectorEnabled(name string) bool {
+	enabled := c.Collectors[name].Enabled
+	return enabled == nil || *enabled
+}
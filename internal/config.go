@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// builtinCollectors lists the names of the collectors always provided by the
+// exporter, which custom endpoints cannot reuse.
+var builtinCollectors = []string{"email_cycle", "email_bounces", "email_history", "email_spam", "email_unsubs"}
+
+// Config is the content of the optional configuration file.
+type Config struct {
+	// Accounts lists the SMTP2GO accounts to export, instead of the one given
+	// on the command line. Their metrics carry an "account" label.
+	Accounts []AccountConfig `yaml:"accounts"`
+	// Endpoints lists additional stats endpoints to export.
+	Endpoints []EndpointDescriptor `yaml:"endpoints"`
+	// Budget limits the number of API calls made by all collectors.
+	Budget BudgetConfig `yaml:"budget"`
+	// Collectors holds per-collector settings, by collector name.
+	Collectors map[string]CollectorConfig `yaml:"collectors"`
+	// EmailHistory holds the settings of the email_history collector.
+	EmailHistory EmailHistoryConfig `yaml:"email_history"`
+	// Thresholds are checked by the check command and the built-in alerting;
+	// unset levels default to DefaultThresholds.
+	Thresholds Thresholds `yaml:"thresholds"`
+	// Alerting holds the settings of the built-in alerting.
+	Alerting AlertingConfig `yaml:"alerting"`
+}
+
+// BudgetConfig is a token-bucket budget of API calls. At most one of the rates
+// may be set; the budget is disabled when neither is.
+type BudgetConfig struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	RequestsPerHour   float64 `yaml:"requests_per_hour"`
+	// Burst is the number of calls that can be made at once, 5 by default so
+	// that a full scrape of the built-in collectors fits.
+	Burst int `yaml:"burst"`
+}
+
+// RequestsPerSecond returns the refill rate of the budget.
+func (b BudgetConfig) RequestsPerSecond() float64 {
+	if b.RequestsPerMinute > 0 {
+		return b.RequestsPerMinute / 60
+	}
+	return b.RequestsPerHour / 3600
+}
+
+// BurstOrDefault returns the burst of the budget.
+func (b BudgetConfig) BurstOrDefault() int {
+	if b.Burst > 0 {
+		return b.Burst
+	}
+	return len(builtinCollectors)
+}
+
+// CollectorConfig holds the settings of a collector.
+type CollectorConfig struct {
+	// Enabled defaults to true.
+	Enabled *bool `yaml:"enabled"`
+	// MinInterval is the minimum time between two API calls of the
+	// collector; scrapes in between reuse the last response.
+	MinInterval time.Duration `yaml:"min_interval"`
+}
+
+// MinIntervals returns the minimum refresh interval of each collector.
+func (c *Config) MinIntervals() map[string]time.Duration {
+	intervals := map[string]time.Duration{}
+	for name, collector := range c.Collectors {
+		if collector.MinInterval > 0 {
+			intervals[name] = collector.MinInterval
+		}
+	}
+	return intervals
+}
+
+// LoadConfig reads and validates a YAML configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// ConfigError is a problem in the configuration, located by the path of the
+// offending setting, e.g. "accounts[1].name".
+type ConfigError struct {
+	Path string
+	// Line is the line of the setting in the configuration file, 0 when
+	// unknown.
+	Line int
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks the configuration for errors, returning the first one.
+func (c *Config) Validate() error {
+	if problems := c.Problems(); len(problems) > 0 {
+		return problems[0]
+	}
+	return nil
+}
+
+// Problems checks the configuration for errors, returning all of them.
+func (c *Config) Problems() []*ConfigError {
+	var problems []*ConfigError
+	report := func(path string, format string, args ...any) {
+		problems = append(problems, &ConfigError{Path: path, Err: fmt.Errorf(format, args...)})
+	}
+
+	problems = append(problems, accountProblems(c.Accounts)...)
+
+	names := map[string]bool{}
+	for _, name := range builtinCollectors {
+		names[name] = true
+	}
+	// owners maps the metric names in use to what exports them, so that an
+	// endpoint cannot collide with another one or with a built-in metric.
+	owners := map[string]string{}
+	if len(c.Endpoints) > 0 {
+		for _, name := range builtinMetricNames() {
+			owners[name] = "the exporter"
+		}
+	}
+	for i, endpoint := range c.Endpoints {
+		path := fmt.Sprintf("endpoints[%d]", i)
+		if err := endpoint.Validate(); err != nil {
+			problems = append(problems, &ConfigError{Path: path, Err: err})
+		}
+		if endpoint.Name != "" && names[endpoint.Name] {
+			report(path+".name", "endpoint %s: name already in use", endpoint.Name)
+		}
+		names[endpoint.Name] = true
+		for _, metric := range endpoint.metrics() {
+			if owner, ok := owners[metric.Name]; ok {
+				report(path, "endpoint %s: metric %q already exported by %s", endpoint.Name, metric.Name, owner)
+				continue
+			}
+			owners[metric.Name] = "endpoint " + endpoint.Name
+		}
+	}
+
+	if c.Budget.RequestsPerMinute < 0 || c.Budget.RequestsPerHour < 0 || c.Budget.Burst < 0 {
+		report("budget", "budget: values must not be negative")
+	}
+	if c.Budget.RequestsPerMinute > 0 && c.Budget.RequestsPerHour > 0 {
+		report("budget", "budget: only one of requests_per_minute and requests_per_hour may be set")
+	}
+
+	var collectors []string
+	for name := range c.Collectors {
+		collectors = append(collectors, name)
+	}
+	sort.Strings(collectors)
+	for _, name := range collectors {
+		if !names[name] {
+			report("collectors."+name, "collectors: unknown collector %q", name)
+		}
+		if c.Collectors[name].MinInterval < 0 {
+			report("collectors."+name+".min_interval", "collectors: %s: min_interval must not be negative", name)
+		}
+	}
+
+	if err := c.EmailHistory.Validate(); err != nil {
+		problems = append(problems, &ConfigError{Path: "email_history", Err: err})
+	}
+	if err := c.Thresholds.Validate(); err != nil {
+		problems = append(problems, &ConfigError{Path: "thresholds", Err: err})
+	}
+	if err := c.Alerting.Validate(); err != nil {
+		problems = append(problems, &ConfigError{Path: "alerting", Err: err})
+	}
+	return problems
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+endpoints:
+  - name: custom
+    fields:
+      - field: emails
+        help: Number of emails
+budget:
+  requests_per_hour: 360
+collectors:
+  email_cycle:
+    min_interval: 5m
+  custom:
+    min_interval: 1h
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Endpoints) != 1 || cfg.Endpoints[0].Name != "custom" {
+		t.Errorf("unexpected endpoints %+v", cfg.Endpoints)
+	}
+	if got := cfg.Budget.RequestsPerSecond(); got != 0.1 {
+		t.Errorf("requests per second = %v, want 0.1", got)
+	}
+	if got := cfg.Budget.BurstOrDefault(); got != 5 {
+		t.Errorf("burst = %v, want 5", got)
+	}
+	intervals := cfg.MinIntervals()
+	if intervals["email_cycle"] != 5*time.Minute || intervals["custom"] != time.Hour {
+		t.Errorf("unexpected intervals %v", intervals)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		err     string
+	}{
+		{"unknown: 1", "field unknown not found"},
+		{"endpoints:\n  - name: email_spam\n    fields: [{field: a}]", "already in use"},
+		{"endpoints:\n  - {name: cycle, namespace: smtp2go_email_cycle, fields: [{field: used}]}", `metric "smtp2go_email_cycle_used" already exported by the exporter`},
+		{"endpoints:\n  - {name: users, namespace: smtp2go_email_history, fields: [{field: sent, name: username_used}]}", "already exported by the exporter"},
+		{"endpoints:\n  - {name: a, namespace: smtp2go_x, fields: [{field: n}]}\n  - {name: b, namespace: smtp2go_x, fields: [{field: n}]}", `metric "smtp2go_x_n" already exported by endpoint a`},
+		{"budget:\n  requests_per_minute: 1\n  requests_per_hour: 60", "only one of"},
+		{"collectors:\n  nope: {}", "unknown collector"},
+		{"collectors:\n  email_cycle:\n    min_interval: soon", "into time.Duration"},
+		{"accounts:\n  - api_key: k", "has no name"},
+		{"accounts:\n  - {name: a, api_key: k}\n  - {name: a, api_key: k}", "duplicate name"},
+		{"accounts:\n  - {name: a}", "exactly one of"},
+		{"accounts:\n  - {name: a, api_key: ' '}", "api_key must not be blank"},
+		{"email_history:\n  include: ['(']", "missing closing )"},
+		{"email_history:\n  top: -1", "must not be negative"},
+		{"email_history:\n  series: [sender]", "unknown series"},
+		{"email_history:\n  group_by: [ip_address]", "unknown grouping"},
+		{"email_history:\n  group_by: [username]\n  series: [domain]", "series need the email_address grouping"},
+		{"email_history:\n  privacy: {mode: hash}", "exactly one of secret and secret_file"},
+		{"email_history:\n  privacy: {mode: mask, lookup: {listen: ':1'}}", "exactly one of token and token_file"},
+		{"alerting:\n  notifiers: [{type: pager, url: 'http://localhost'}]", "unknown type \"pager\""},
+		{"alerting:\n  notifiers: [{type: slack, url: hooks.slack.com}]", "url must be an http or https URL"},
+		{"alerting:\n  failed_api_calls: {warning: 3, critical: 1}", "critical level must not be below"},
+		{"alerting:\n  failed_api_calls: {critical: 1}", "critical level must not be below"},
+		{"alerting:\n  failed_api_calls_window: -1m", "failed_api_calls_window must not be negative"},
+		{"alerting:\n  max_data_age: -1m", "max_data_age must not be negative"},
+	} {
+		_, err := LoadConfig(writeConfig(t, tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: got error %v, want %q", tc.content, err, tc.err)
+		}
+	}
+}
+
+func TestCollectorEnabled(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, "collectors:\n  email_history:\n    enabled: false"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CollectorEnabled("email_history") {
+		t.Error("email_history is enabled")
+	}
+	if !cfg.CollectorEnabled("email_cycle") {
+		t.Error("email_cycle is disabled")
+	}
+	if got := len(NewCollectors(&Client{}, cfg, nil)); got != 4 {
+		t.Errorf("got %d collectors, want 4", got)
+	}
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxPreviousCycles is the number of previous cycles kept in the history.
+const maxPreviousCycles = 12
+
+// cycleUsage is the usage of a cycle, as last observed.
+type cycleUsage struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Used  float64   `json:"used"`
+	// ObservedAt is when Used was observed, zero in histories saved before
+	// it was recorded.
+	ObservedAt time.Time `json:"observed_at,omitzero"`
+}
+
+// observedDays returns the number of days between the start of the cycle
+// and its last observation, or its end if it was observed after it or
+// before observations were recorded.
+func (u cycleUsage) observedDays() float64 {
+	until := u.End
+	if !u.ObservedAt.IsZero() && u.ObservedAt.Before(until) {
+		until = u.ObservedAt
+	}
+	return until.Sub(u.Start).Hours() / 24
+}
+
+// cycleHistory keeps the usage of the current and previous cycles of an
+// account, saved to a JSON file when path is set so that it survives
+// restarts.
+type cycleHistory struct {
+	path     string
+	Current  *cycleUsage  `json:"current,omitempty"`
+	Previous []cycleUsage `json:"previous"`
+}
+
+// loadCycleHistory reads the history saved at path. It starts empty if there
+// is none or it cannot be read.
+func loadCycleHistory(path string) *cycleHistory {
+	h := &cycleHistory{path: path}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h
+	}
+	if err == nil {
+		err = json.Unmarshal(data, h)
+	}
+	if err != nil {
+		log.Println("[email_cycle] Failed to load the cycle history, starting afresh:", err)
+		return &cycleHistory{path: path}
+	}
+	return h
+}
+
+// observe records the usage of the cycle starting at start, observed at t.
+// The current cycle moves to the previous ones once a later cycle is
+// observed. An unchanged usage is only saved again hourly.
+func (h *cycleHistory) observe(start, end time.Time, used float64, t time.Time) {
+	switch {
+	case h.Current == nil:
+		h.Current = &cycleUsage{Start: start, End: end, Used: used, ObservedAt: t}
+	case h.Current.Start.Equal(start):
+		if h.Current.End.Equal(end) && h.Current.Used == used && t.Sub(h.Current.ObservedAt) < time.Hour {
+			return
+		}
+		h.Current.End, h.Current.Used, h.Current.ObservedAt = end, used, t
+	case start.After(h.Current.Start):
+		h.Previous = append(h.Previous, *h.Current)
+		if len(h.Previous) > maxPreviousCycles {
+			h.Previous = h.Previous[len(h.Previous)-maxPreviousCycles:]
+		}
+		h.Current = &cycleUsage{Start: start, End: end, Used: used, ObservedAt: t}
+	default:
+		// An earlier cycle, e.g. replayed responses.
+		return
+	}
+	h.save()
+}
+
+// dailyAverage returns the average number of emails used per day during the
+// previous cycles, over the part of them which was observed, or false if
+// there are none.
+func (h *cycleHistory) dailyAverage() (float64, bool) {
+	var used, days float64
+	for _, cycle := range h.Previous {
+		used += cycle.Used
+		days += cycle.observedDays()
+	}
+	if days <= 0 {
+		return 0, false
+	}
+	return used / days, true
+}
+
+// save writes the history to its file, if any, replacing it atomically.
+func (h *cycleHistory) save() {
+	if h.path == "" {
+		return
+	}
+	data, err := json.Marshal(h)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(h.path), 0o755)
+	}
+	if err == nil {
+		tmp := h.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, h.path)
+		}
+	}
+	if err != nil {
+		log.Println("[email_cycle] Failed to save the cycle history:", err)
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCycleHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "email_cycle.json")
+	h := loadCycleHistory(path)
+	day := func(d int) time.Time { return time.Date(2025, time.January, d, 0, 0, 0, 0, time.UTC) }
+
+	h.observe(day(1), day(11), 50, day(5))
+	h.observe(day(1), day(11), 100, day(11))
+	if _, ok := h.dailyAverage(); ok {
+		t.Error("daily average without previous cycles")
+	}
+	h.observe(day(11), day(16), 10, day(16))
+	h.observe(day(1), day(11), 500, day(16)) // an earlier cycle is ignored
+	h.observe(day(16), day(21), 20, day(17))
+	if got, ok := h.dailyAverage(); !ok || got != 110.0/15 {
+		t.Errorf("daily average = %v, %v, want %v", got, ok, 110.0/15)
+	}
+
+	// The history survives a restart.
+	reloaded := loadCycleHistory(path)
+	if got, _ := reloaded.dailyAverage(); got != 110.0/15 {
+		t.Errorf("reloaded daily average = %v, want %v", got, 110.0/15)
+	}
+	if reloaded.Current == nil || reloaded.Current.Used != 20 {
+		t.Errorf("reloaded current cycle = %+v", reloaded.Current)
+	}
+
+	for i := 0; i < 2*maxPreviousCycles; i++ {
+		h.observe(day(21).AddDate(0, i, 0), day(21).AddDate(0, i+1, 0), 1, day(21).AddDate(0, i+1, 0))
+	}
+	if len(h.Previous) != maxPreviousCycles {
+		t.Errorf("kept %d previous cycles, want %d", len(h.Previous), maxPreviousCycles)
+	}
+}
+
+func TestCycleHistoryObservedSpan(t *testing.T) {
+	h := loadCycleHistory("")
+	day := func(d int) time.Time { return time.Date(2025, time.January, d, 0, 0, 0, 0, time.UTC) }
+
+	// The exporter stopped observing the first cycle after 4 days.
+	h.observe(day(1), day(11), 40, day(5))
+	h.observe(day(1), day(11), 40, day(5).Add(30*time.Minute))
+	if got := h.Current.ObservedAt; !got.Equal(day(5)) {
+		t.Errorf("unchanged usage observed at %v, want %v until an hour passed", got, day(5))
+	}
+	h.observe(day(11), day(21), 0, day(20))
+	if got, ok := h.dailyAverage(); !ok || got != 10 {
+		t.Errorf("daily average = %v, %v, want 10", got, ok)
+	}
+
+	// Cycles saved without an observation time span until their end.
+	h.Previous = []cycleUsage{{Start: day(1), End: day(11), Used: 40}}
+	if got, _ := h.dailyAverage(); got != 4 {
+		t.Errorf("daily average = %v, want 4", got)
+	}
+}
+
+func TestCycleHistoryCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "email_cycle.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := loadCycleHistory(path)
+	if h.Current != nil || len(h.Previous) != 0 {
+		t.Errorf("got %+v, want an empty history", h)
+	}
+}
@@ -0,0 +1,495 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strings"
+)
+
+// Dashboard is a Grafana dashboard, as imported from JSON.
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Description   string     `json:"description,omitempty"`
+	Tags          []string   `json:"tags"`
+	Editable      bool       `json:"editable"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+// TimeRange is the default time range of a dashboard.
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Templating holds the template variables of a dashboard.
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+// Variable is a template variable of a dashboard.
+type Variable struct {
+	Name       string         `json:"name"`
+	Label      string         `json:"label"`
+	Type       string         `json:"type"`
+	Query      string         `json:"query"`
+	Definition string         `json:"definition,omitempty"`
+	Datasource *DatasourceRef `json:"datasource,omitempty"`
+	Refresh    int            `json:"refresh,omitempty"`
+	IncludeAll bool           `json:"includeAll,omitempty"`
+	AllValue   string         `json:"allValue,omitempty"`
+	Multi      bool           `json:"multi,omitempty"`
+	Sort       int            `json:"sort,omitempty"`
+}
+
+// DatasourceRef designates the data source of a panel or variable.
+type DatasourceRef struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// Panel is a panel of a dashboard. Rows are panels too, holding their
+// panels when collapsed.
+type Panel struct {
+	ID          int            `json:"id"`
+	Type        string         `json:"type"`
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	GridPos     GridPos        `json:"gridPos"`
+	Datasource  *DatasourceRef `json:"datasource,omitempty"`
+	Targets     []Target       `json:"targets,omitempty"`
+	FieldConfig *FieldConfig   `json:"fieldConfig,omitempty"`
+	Options     map[string]any `json:"options,omitempty"`
+	Collapsed   bool           `json:"collapsed,omitempty"`
+	Panels      []Panel        `json:"panels,omitempty"`
+}
+
+// GridPos is the position of a panel on the 24 columns wide grid.
+type GridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Target is a query of a panel.
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Instant      bool   `json:"instant,omitempty"`
+	Format       string `json:"format,omitempty"`
+}
+
+// FieldConfig holds the display settings of the values of a panel.
+type FieldConfig struct {
+	Defaults  FieldDefaults `json:"defaults"`
+	Overrides []any         `json:"overrides"`
+}
+
+// FieldDefaults are the display settings of all values of a panel.
+type FieldDefaults struct {
+	Unit       string           `json:"unit,omitempty"`
+	Decimals   *int             `json:"decimals,omitempty"`
+	Min        *float64         `json:"min,omitempty"`
+	Max        *float64         `json:"max,omitempty"`
+	Thresholds *FieldThresholds `json:"thresholds,omitempty"`
+	Custom     map[string]any   `json:"custom,omitempty"`
+}
+
+// FieldThresholds colour values by level.
+type FieldThresholds struct {
+	Mode  string          `json:"mode"`
+	Steps []ThresholdStep `json:"steps"`
+}
+
+// ThresholdStep is the colour of the values from a level up. The level of
+// the first step is null.
+type ThresholdStep struct {
+	Color string   `json:"color"`
+	Value *float64 `json:"value"`
+}
+
+// datasource is the data source of every panel, chosen through the
+// datasource variable.
+var datasource = &DatasourceRef{Type: "prometheus", UID: "${datasource}"}
+
+// dashboardLayout places panels on the grid, left to right then top to
+// bottom, and numbers them.
+type dashboardLayout struct {
+	panels []Panel
+	// pending is the row to add before the next panel, and row the
+	// collapsed row receiving the panels, if any.
+	pending *Panel
+	row     *Panel
+	x, y, h int
+	id      int
+}
+
+// add places panel with the given size after the previous one.
+func (l *dashboardLayout) add(panel Panel, w, h int) {
+	if l.pending != nil {
+		row := *l.pending
+		l.pending, l.row = nil, nil
+		l.x, l.y, l.h = 0, l.y+l.h, 0
+		l.place(row, 24, 1)
+		l.x, l.y, l.h = 0, l.y+1, 0
+		if row.Collapsed {
+			l.row = &l.panels[len(l.panels)-1]
+		}
+	}
+	if l.x+w > 24 {
+		l.x, l.y, l.h = 0, l.y+l.h, 0
+	}
+	l.place(panel, w, h)
+}
+
+func (l *dashboardLayout) place(panel Panel, w, h int) {
+	l.id++
+	panel.ID = l.id
+	panel.GridPos = GridPos{X: l.x, Y: l.y, W: w, H: h}
+	l.x += w
+	l.h = max(l.h, h)
+	if l.row != nil {
+		l.row.Panels = append(l.row.Panels, panel)
+	} else {
+		l.panels = append(l.panels, panel)
+	}
+}
+
+// addRow starts a new row of panels, hidden until it is expanded if
+// collapsed. Rows without panels are left out.
+func (l *dashboardLayout) addRow(title string, collapsed bool) {
+	l.pending = &Panel{Type: "row", Title: title, Collapsed: collapsed}
+}
+
+// selector selects the series of the metric of the chosen accounts.
+func selector(metric string) string {
+	return metric + `{account=~"$account"}`
+}
+
+// GenerateDashboard returns a Grafana dashboard of metrics, as returned by
+// Metrics, colouring the rates with thresholds. Panels of metrics which are
+// not exported are left out, and the metrics without a dedicated panel are
+// graphed in a collapsed row.
+func GenerateDashboard(metrics []Metric, thresholds Thresholds) Dashboard {
+	exported := map[string]Metric{}
+	for _, metric := range metrics {
+		exported[metric.Name] = metric
+	}
+	shown := map[string]bool{}
+	has := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := exported[name]; !ok {
+				return false
+			}
+		}
+		for _, name := range names {
+			shown[name] = true
+		}
+		return true
+	}
+	// describe returns the help texts of the metrics, as panel description.
+	describe := func(names ...string) string {
+		var help []string
+		for _, name := range names {
+			help = append(help, name+": "+exported[name].Help+".")
+		}
+		return strings.Join(help, "\n")
+	}
+	zero, one, two, percent := 0.0, 1.0, 2.0, 100.0
+
+	var l dashboardLayout
+	l.addRow("Cycle", false)
+	if has("smtp2go_email_cycle_used", "smtp2go_email_cycle_max") {
+		panel := Panel{
+			Type:        "timeseries",
+			Title:       "Cycle usage",
+			Description: describe("smtp2go_email_cycle_used", "smtp2go_email_cycle_max"),
+			Datasource:  datasource,
+			Targets: []Target{
+				{RefID: "A", Expr: selector("smtp2go_email_cycle_used"), LegendFormat: "used {{account}}"},
+				{RefID: "B", Expr: selector("smtp2go_email_cycle_max"), LegendFormat: "max {{account}}"},
+			},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: "short", Min: &zero}, Overrides: []any{}},
+		}
+		if has("smtp2go_email_cycle_ideal_used") {
+			panel.Description += "\n" + describe("smtp2go_email_cycle_ideal_used")
+			panel.Targets = append(panel.Targets, Target{RefID: "C", Expr: selector("smtp2go_email_cycle_ideal_used"), LegendFormat: "ideal {{account}}"})
+		}
+		l.add(panel, 12, 8)
+	}
+	if has("smtp2go_email_cycle_remaining", "smtp2go_email_cycle_max") {
+		l.add(Panel{
+			Type:        "gauge",
+			Title:       "Cycle quota remaining",
+			Description: describe("smtp2go_email_cycle_remaining", "smtp2go_email_cycle_max"),
+			Datasource:  datasource,
+			Targets: []Target{{
+				RefID:        "A",
+				Expr:         "100 * " + selector("smtp2go_email_cycle_remaining") + " / (" + selector("smtp2go_email_cycle_max") + " > 0)",
+				LegendFormat: "{{account}}",
+			}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{
+				Unit: "percent", Min: &zero, Max: &percent,
+				Thresholds: levelColors(thresholds.CycleRemainingPercent, true),
+			}, Overrides: []any{}},
+		}, 6, 8)
+	}
+	if has("smtp2go_email_cycle_remaining_seconds") {
+		l.add(Panel{
+			Type:        "stat",
+			Title:       "Cycle time remaining",
+			Description: describe("smtp2go_email_cycle_remaining_seconds"),
+			Datasource:  datasource,
+			Targets:     []Target{{RefID: "A", Expr: selector("smtp2go_email_cycle_remaining_seconds"), LegendFormat: "{{account}}"}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: "s"}, Overrides: []any{}},
+		}, 6, 8)
+	}
+
+	if has("smtp2go_email_cycle_daily_budget", "smtp2go_email_cycle_previous_daily_average") {
+		l.add(Panel{
+			Type:        "timeseries",
+			Title:       "Daily budget",
+			Description: describe("smtp2go_email_cycle_daily_budget", "smtp2go_email_cycle_previous_daily_average"),
+			Datasource:  datasource,
+			Targets: []Target{
+				{RefID: "A", Expr: selector("smtp2go_email_cycle_daily_budget"), LegendFormat: "budget {{account}}"},
+				{RefID: "B", Expr: selector("smtp2go_email_cycle_previous_daily_average"), LegendFormat: "previous cycles {{account}}"},
+			},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: "short", Min: &zero}, Overrides: []any{}},
+		}, 12, 8)
+	}
+	if has("smtp2go_email_cycle_used_over_ideal") {
+		l.add(Panel{
+			Type:        "timeseries",
+			Title:       "Usage against the ideal pace",
+			Description: describe("smtp2go_email_cycle_used_over_ideal"),
+			Datasource:  datasource,
+			Targets:     []Target{{RefID: "A", Expr: selector("smtp2go_email_cycle_used_over_ideal"), LegendFormat: "{{account}}"}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: "short"}, Overrides: []any{}},
+		}, 12, 8)
+	}
+
+	l.addRow("Deliverability", false)
+	for _, rate := range []struct {
+		title, metric string
+		threshold     Threshold
+	}{
+		{"Bounce rate", "smtp2go_email_bounces_bounce_percent", thresholds.BouncePercent},
+		{"Spam rate", "smtp2go_email_spam_spam_percent", thresholds.SpamPercent},
+		{"Unsubscribe rate", "smtp2go_email_unsubs_unsubscribe_percent", Threshold{}},
+	} {
+		if !has(rate.metric) {
+			continue
+		}
+		l.add(Panel{
+			Type:        "timeseries",
+			Title:       rate.title,
+			Description: describe(rate.metric),
+			Datasource:  datasource,
+			Targets:     []Target{{RefID: "A", Expr: selector(rate.metric), LegendFormat: "{{account}}"}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{
+				Unit: "percent", Min: &zero,
+				Thresholds: levelColors(rate.threshold, false),
+				Custom:     map[string]any{"thresholdsStyle": map[string]any{"mode": "line"}},
+			}, Overrides: []any{}},
+		}, 8, 8)
+	}
+
+	l.addRow("Senders", false)
+	for _, top := range []struct {
+		title, metric, unit string
+	}{
+		{"Top senders", "smtp2go_email_history_used", "short"},
+		{"Top senders by bounce ratio", "smtp2go_email_history_bounce_ratio", "percentunit"},
+	} {
+		if !has(top.metric) {
+			continue
+		}
+		l.add(Panel{
+			Type:        "bargauge",
+			Title:       top.title,
+			Description: describe(top.metric),
+			Datasource:  datasource,
+			Targets: []Target{{
+				RefID:        "A",
+				Expr:         "topk(10, " + selector(top.metric) + ")",
+				LegendFormat: "{{email_address}} {{account}}",
+				Instant:      true,
+			}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: top.unit, Min: &zero}, Overrides: []any{}},
+			Options:     map[string]any{"orientation": "horizontal", "displayMode": "basic"},
+		}, 12, 10)
+	}
+
+	l.addRow("Exporter health", false)
+	if has("smtp2go_scrape_collector_success") {
+		l.add(Panel{
+			Type:        "state-timeline",
+			Title:       "Collector success",
+			Description: describe("smtp2go_scrape_collector_success"),
+			Datasource:  datasource,
+			Targets:     []Target{{RefID: "A", Expr: selector("smtp2go_scrape_collector_success"), LegendFormat: "{{collector}} {{account}}"}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Thresholds: &FieldThresholds{
+				Mode:  "absolute",
+				Steps: []ThresholdStep{{Color: "red"}, {Color: "green", Value: &one}},
+			}}, Overrides: []any{}},
+		}, 12, 8)
+	}
+	if has("smtp2go_api_requests_total") {
+		l.add(Panel{
+			Type:        "timeseries",
+			Title:       "API requests",
+			Description: describe("smtp2go_api_requests_total"),
+			Datasource:  datasource,
+			Targets: []Target{{
+				RefID:        "A",
+				Expr:         "sum by (account, code) (rate(" + selector("smtp2go_api_requests_total") + "[$__rate_interval]))",
+				LegendFormat: "{{code}} {{account}}",
+			}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: "reqps", Min: &zero}, Overrides: []any{}},
+		}, 12, 8)
+	}
+	if has("smtp2go_api_circuit_state") {
+		l.add(Panel{
+			Type:        "timeseries",
+			Title:       "Circuit breakers",
+			Description: describe("smtp2go_api_circuit_state"),
+			Datasource:  datasource,
+			Targets:     []Target{{RefID: "A", Expr: selector("smtp2go_api_circuit_state"), LegendFormat: "{{endpoint}} {{account}}"}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Min: &zero, Max: &two}, Overrides: []any{}},
+		}, 12, 8)
+	}
+	if has("smtp2go_parse_errors_total") {
+		l.add(Panel{
+			Type:        "timeseries",
+			Title:       "Parse errors",
+			Description: describe("smtp2go_parse_errors_total"),
+			Datasource:  datasource,
+			Targets: []Target{{
+				RefID:        "A",
+				Expr:         "increase(" + selector("smtp2go_parse_errors_total") + "[$__rate_interval])",
+				LegendFormat: "{{collector}} {{field}} {{account}}",
+			}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: "short", Min: &zero}, Overrides: []any{}},
+		}, 12, 8)
+	}
+
+	l.addRow("All metrics", true)
+	for _, metric := range metrics {
+		if shown[metric.Name] {
+			continue
+		}
+		expr := selector(metric.Name)
+		if strings.HasSuffix(metric.Name, "_total") {
+			expr = "rate(" + expr + "[$__rate_interval])"
+		}
+		if len(metric.Labels) > 0 {
+			expr = "topk(10, " + expr + ")"
+		}
+		l.add(Panel{
+			Type:        "timeseries",
+			Title:       metric.Name,
+			Description: exported[metric.Name].Help + ".",
+			Datasource:  datasource,
+			Targets:     []Target{{RefID: "A", Expr: expr}},
+			FieldConfig: &FieldConfig{Defaults: FieldDefaults{Unit: metricUnit(metric.Name)}, Overrides: []any{}},
+		}, 8, 8)
+	}
+
+	return Dashboard{
+		UID:           "smtp2go-exporter",
+		Title:         "SMTP2GO",
+		Description:   "Usage and deliverability of SMTP2GO accounts, from smtp2go_exporter.",
+		Tags:          []string{"smtp2go"},
+		Editable:      true,
+		SchemaVersion: 39,
+		Refresh:       "5m",
+		Time:          TimeRange{From: "now-7d", To: "now"},
+		Templating: Templating{List: []Variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			{
+				Name:       "account",
+				Label:      "Account",
+				Type:       "query",
+				Query:      "label_values(smtp2go_scrape_collector_success, account)",
+				Definition: "label_values(smtp2go_scrape_collector_success, account)",
+				Datasource: datasource,
+				Refresh:    2,
+				IncludeAll: true,
+				AllValue:   ".*",
+				Multi:      true,
+				Sort:       1,
+			},
+		}},
+		Panels: l.panels,
+	}
+}
+
+// levelColors colours values by the levels of threshold, breached below or
+// above them.
+func levelColors(threshold Threshold, below bool) *FieldThresholds {
+	if threshold.Warning == nil && threshold.Critical == nil {
+		return nil
+	}
+	var steps []ThresholdStep
+	if below {
+		base, critical := "red", "orange"
+		if threshold.Critical == nil {
+			base = "orange"
+		}
+		if threshold.Warning == nil {
+			critical = "green"
+		}
+		steps = []ThresholdStep{{Color: base}}
+		if threshold.Critical != nil {
+			steps = append(steps, ThresholdStep{Color: critical, Value: threshold.Critical})
+		}
+		if threshold.Warning != nil {
+			steps = append(steps, ThresholdStep{Color: "green", Value: threshold.Warning})
+		}
+	} else {
+		steps = []ThresholdStep{{Color: "green"}}
+		if threshold.Warning != nil {
+			steps = append(steps, ThresholdStep{Color: "orange", Value: threshold.Warning})
+		}
+		if threshold.Critical != nil {
+			steps = append(steps, ThresholdStep{Color: "red", Value: threshold.Critical})
+		}
+	}
+	return &FieldThresholds{Mode: "absolute", Steps: steps}
+}
+
+// metricUnit returns the Grafana unit of the values of the named metric.
+func metricUnit(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_percent"):
+		return "percent"
+	case strings.HasSuffix(name, "_ratio"):
+		return "percentunit"
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_bytecount"), strings.HasSuffix(name, "_avgsize"):
+		return "bytes"
+	case strings.HasSuffix(name, "_total"):
+		return "ops"
+	}
+	return "short"
+}
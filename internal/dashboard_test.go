@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// dashboardPanels returns the panels of dashboard, those of collapsed rows
+// included, by title.
+func dashboardPanels(dashboard Dashboard) map[string]Panel {
+	panels := map[string]Panel{}
+	var walk func([]Panel)
+	walk = func(list []Panel) {
+		for _, panel := range list {
+			panels[panel.Title] = panel
+			walk(panel.Panels)
+		}
+	}
+	walk(dashboard.Panels)
+	return panels
+}
+
+func TestGenerateDashboard(t *testing.T) {
+	metrics := Metrics(&Config{})
+	dashboard := GenerateDashboard(metrics, DefaultThresholds())
+	panels := dashboardPanels(dashboard)
+
+	for _, title := range []string{"Cycle usage", "Cycle quota remaining", "Cycle time remaining", "Bounce rate", "Spam rate", "Unsubscribe rate", "Top senders", "Collector success", "API requests"} {
+		if _, ok := panels[title]; !ok {
+			t.Errorf("no %q panel", title)
+		}
+	}
+	// Every metric is graphed, in a dedicated panel or in the row of all
+	// metrics.
+	for _, metric := range metrics {
+		found := false
+		for _, panel := range panels {
+			for _, target := range panel.Targets {
+				found = found || strings.Contains(target.Expr, metric.Name+"{")
+			}
+		}
+		if !found {
+			t.Errorf("%s is not graphed", metric.Name)
+		}
+	}
+	for _, panel := range panels {
+		for _, target := range panel.Targets {
+			if !strings.Contains(target.Expr, `{account=~"$account"}`) {
+				t.Errorf("%s: %s does not select the account", panel.Title, target.Expr)
+			}
+		}
+	}
+
+	if got := panels["Spam rate"].FieldConfig.Defaults.Thresholds.Steps; len(got) != 3 || *got[1].Value != 0.1 || *got[2].Value != 0.3 {
+		t.Errorf("unexpected spam rate thresholds %+v", got)
+	}
+	variables := dashboard.Templating.List
+	if len(variables) != 2 || variables[1].Name != "account" {
+		t.Errorf("unexpected variables %+v", variables)
+	}
+}
+
+func TestGenerateDashboardLayout(t *testing.T) {
+	disabled := false
+	cfg := &Config{Collectors: map[string]CollectorConfig{"email_history": {Enabled: &disabled}}}
+	dashboard := GenerateDashboard(Metrics(cfg), DefaultThresholds())
+
+	ids := map[int]bool{}
+	y := 0
+	for _, panel := range dashboard.Panels {
+		if panel.Title == "Senders" {
+			t.Error("row of senders without email history")
+		}
+		if ids[panel.ID] {
+			t.Errorf("duplicate id %d", panel.ID)
+		}
+		ids[panel.ID] = true
+		if pos := panel.GridPos; pos.Y < y || pos.X+pos.W > 24 {
+			t.Errorf("%s misplaced at %+v", panel.Title, pos)
+		}
+		y = panel.GridPos.Y
+	}
+}
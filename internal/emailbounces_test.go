@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestEmailBouncesCollector(t *testing.T) {
+	server, client := newTestServer(t)
+
+	values := collectValues(t, NewEmailBouncesCollector(client))
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_bounces_emails":                                414,
+		"smtp2go_email_bounces_rejects":                               108,
+		"smtp2go_email_bounces_softbounces":                           3,
+		"smtp2go_email_bounces_hardbounces":                           5,
+		"smtp2go_email_bounces_bounce_percent":                        1.25,
+		"smtp2go_email_bounces_bounce_ratio":                          0.0125,
+		`smtp2go_scrape_collector_success{collector="email_bounces"}`: 1,
+	})
+	if got := server.RequestCount("/stats/email_bounces"); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestEmailBouncesCollectorPercentEncodings(t *testing.T) {
+	server, client := newTestServer(t)
+	collector := NewEmailBouncesCollector(client)
+
+	for percent, want := range map[string]float64{
+		`12.5`:    12.5,
+		`"12.5"`:  12.5,
+		`"12.5%"`: 12.5,
+	} {
+		server.SetBody("/stats/email_bounces", `{"data":{"bounce_percent":`+percent+`}}`)
+		values := collectValues(t, collector)
+		if got := values["smtp2go_email_bounces_bounce_percent"]; got != want {
+			t.Errorf("bounce_percent %s: got %v, want %v", percent, got, want)
+		}
+		if got := values["smtp2go_email_bounces_bounce_ratio"]; got != want/100 {
+			t.Errorf("bounce_percent %s: ratio %v, want %v", percent, got, want/100)
+		}
+	}
+}
+
+func TestEmailBouncesCollectorMissingPercent(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetBody("/stats/email_bounces", `{"data":{"emails":0,"rejects":0,"softbounces":0,"hardbounces":0,"bounce_percent":""}}`)
+
+	values := collectValues(t, NewEmailBouncesCollector(client))
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_bounces_emails":                                0,
+		"smtp2go_email_bounces_rejects":                               0,
+		"smtp2go_email_bounces_softbounces":                           0,
+		"smtp2go_email_bounces_hardbounces":                           0,
+		`smtp2go_scrape_collector_success{collector="email_bounces"}`: 1,
+	})
+}
+
+func TestEmailBouncesCollectorError(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetResponse("/stats/email_bounces", smtp2gotest.Error(http.StatusForbidden))
+
+	values := collectValues(t, NewEmailBouncesCollector(client))
+	assertValues(t, values, map[string]float64{
+		`smtp2go_scrape_collector_success{collector="email_bounces"}`: 0,
+	})
+}
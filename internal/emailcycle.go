@@ -17,6 +17,8 @@ package internal
 import (
 	"encoding/json"
 	"log"
+	"math"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -24,11 +26,11 @@ import (
 )
 
 type EmailCycleData struct {
-	CycleStart     string  `json:"cycle_start"`
-	CycleEnd       string  `json:"cycle_end"`
-	CycleUsed      float64 `json:"cycle_used"`
-	CycleRemaining float64 `json:"cycle_remaining"`
-	CycleMax       float64 `json:"cycle_max"`
+	CycleStart     string `json:"cycle_start"`
+	CycleEnd       string `json:"cycle_end"`
+	CycleUsed      Number `json:"cycle_used"`
+	CycleRemaining Number `json:"cycle_remaining"`
+	CycleMax       Number `json:"cycle_max"`
 }
 
 type EmailCycleResponse struct {
@@ -36,87 +38,167 @@ type EmailCycleResponse struct {
 	Data      EmailCycleData `json:"data"`
 }
 
+// The metrics of the email_cycle collector.
+var (
+	cycleUsedMetric = Metric{
+		Name: "smtp2go_email_cycle_used",
+		Help: "Number of emails used in the current cycle",
+	}
+	cycleRemainingMetric = Metric{
+		Name: "smtp2go_email_cycle_remaining",
+		Help: "Number of emails remaining in the current cycle",
+	}
+	cycleMaxMetric = Metric{
+		Name: "smtp2go_email_cycle_max",
+		Help: "Maximum number of emails allowed in the current cycle",
+	}
+	cycleRemainingSecondsMetric = Metric{
+		Name: "smtp2go_email_cycle_remaining_seconds",
+		Help: "Seconds remaining until the end of the current cycle",
+	}
+	cycleIdealUsedMetric = Metric{
+		Name: "smtp2go_email_cycle_ideal_used",
+		Help: "Number of emails used so far at the linear pace using the maximum by the end of the cycle",
+	}
+	cycleUsedOverIdealMetric = Metric{
+		Name: "smtp2go_email_cycle_used_over_ideal",
+		Help: "Number of emails used beyond the ideal linear pace, negative when behind it",
+	}
+	cycleDailyBudgetMetric = Metric{
+		Name: "smtp2go_email_cycle_daily_budget",
+		Help: "Number of emails remaining per day left in the current cycle, the current day included",
+	}
+	cyclePreviousDailyMetric = Metric{
+		Name: "smtp2go_email_cycle_previous_daily_average",
+		Help: "Average number of emails used per day during the previous cycles, as far as the exporter observed them",
+	}
+)
+
 type EmailCycleCollector struct {
 	mutex     sync.Mutex
-	apiURL    string
-	apiKey    string
-	debug     bool
+	client    *Client
 	namespace string
 
-	used             prometheus.Gauge
-	remaining        prometheus.Gauge
-	max              prometheus.Gauge
-	remainingSeconds prometheus.Gauge
+	used             *prometheus.Desc
+	remaining        *prometheus.Desc
+	max              *prometheus.Desc
+	remainingSeconds *prometheus.Desc
+	idealUsed        *prometheus.Desc
+	usedOverIdeal    *prometheus.Desc
+	dailyBudget      *prometheus.Desc
+	previousDaily    *prometheus.Desc
+	success          *prometheus.Desc
+
+	history *cycleHistory
 }
 
-func NewEmailCycleCollector(apiURL, apiKey string, debug bool) *EmailCycleCollector {
+func NewEmailCycleCollector(client *Client) *EmailCycleCollector {
 	ns := "smtp2go_email_cycle"
 
+	history := loadCycleHistory("")
+	if client.opts.StateDir != "" {
+		history = loadCycleHistory(filepath.Join(client.opts.StateDir, "email_cycle.json"))
+	}
+
 	return &EmailCycleCollector{
-		apiURL:    apiURL,
-		apiKey:    apiKey,
-		debug:     debug,
-		namespace: ns,
-		used: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "used",
-			Help:      "Number of emails used in the current cycle",
-		}),
-		remaining: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "remaining",
-			Help:      "Number of emails remaining in the current cycle",
-		}),
-		max: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "max",
-			Help:      "Maximum number of emails allowed in the current cycle",
-		}),
-		remainingSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "remaining_seconds",
-			Help:      "Seconds remaining until the end of the current cycle",
-		}),
+		client:           client,
+		namespace:        ns,
+		history:          history,
+		used:             cycleUsedMetric.desc(nil),
+		remaining:        cycleRemainingMetric.desc(nil),
+		max:              cycleMaxMetric.desc(nil),
+		remainingSeconds: cycleRemainingSecondsMetric.desc(nil),
+		idealUsed:        cycleIdealUsedMetric.desc(nil),
+		usedOverIdeal:    cycleUsedOverIdealMetric.desc(nil),
+		dailyBudget:      cycleDailyBudgetMetric.desc(nil),
+		previousDaily:    cyclePreviousDailyMetric.desc(nil),
+		success:          newSuccessDesc("email_cycle"),
+	}
+}
+
+// metrics lists the metrics of the collector, as described by Describe.
+func (c *EmailCycleCollector) metrics() []Metric {
+	return []Metric{
+		cycleUsedMetric, cycleRemainingMetric, cycleMaxMetric, cycleRemainingSecondsMetric,
+		cycleIdealUsedMetric, cycleUsedOverIdealMetric, cycleDailyBudgetMetric, cyclePreviousDailyMetric,
+		successMetric,
 	}
 }
 
 func (c *EmailCycleCollector) Describe(ch chan<- *prometheus.Desc) {
-	c.used.Describe(ch)
-	c.remaining.Describe(ch)
-	c.max.Describe(ch)
-	c.remainingSeconds.Describe(ch)
+	ch <- c.used
+	ch <- c.remaining
+	ch <- c.max
+	ch <- c.remainingSeconds
+	ch <- c.idealUsed
+	ch <- c.usedOverIdeal
+	ch <- c.dailyBudget
+	ch <- c.previousDaily
+	ch <- c.success
 }
 
 func (c *EmailCycleCollector) Collect(ch chan<- prometheus.Metric) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	body, err := doPostRequest(c.apiURL, "/stats/email_cycle", c.apiKey, c.debug, "email_cycle")
+	body, err := c.client.Fetch("/stats/email_cycle", "email_cycle")
 	if err != nil {
+		sendSuccess(ch, c.success, false)
 		return
 	}
 
 	var apiResp EmailCycleResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
 		log.Println("[email_cycle] Failed to parse JSON:", err)
+		sendSuccess(ch, c.success, false)
 		return
 	}
+	sendSuccess(ch, c.success, true)
 
 	data := apiResp.Data
-	c.used.Set(data.CycleUsed)
-	c.remaining.Set(data.CycleRemaining)
-	c.max.Set(data.CycleMax)
+	sendNumber(ch, c.used, "email_cycle", "cycle_used", data.CycleUsed)
+	sendNumber(ch, c.remaining, "email_cycle", "cycle_remaining", data.CycleRemaining)
+	sendNumber(ch, c.max, "email_cycle", "cycle_max", data.CycleMax)
 
-	endTime, err := time.Parse("2006-01-02 15:04:05-07:00", data.CycleEnd)
+	endTime, err := parseTimestamp(data.CycleEnd)
 	if err != nil {
 		log.Println("[email_cycle] Failed to parse cycle_end timestamp:", err)
-	} else {
-		remainingSeconds := time.Until(endTime).Seconds()
-		c.remainingSeconds.Set(remainingSeconds)
+		ParseErrors.WithLabelValues("email_cycle", "cycle_end").Inc()
+		return
+	}
+	clock := c.client.clock("/stats/email_cycle")
+	remaining := endTime.Sub(clock)
+	ch <- prometheus.MustNewConstMetric(c.remainingSeconds, prometheus.GaugeValue, remaining.Seconds())
+	if remaining > 0 && data.CycleRemaining.Valid {
+		// The emails of a day can be sent until it ends.
+		days := max(math.Ceil(remaining.Hours()/24), 1)
+		ch <- prometheus.MustNewConstMetric(c.dailyBudget, prometheus.GaugeValue, data.CycleRemaining.Value/days)
+	}
+
+	startTime, err := parseTimestamp(data.CycleStart)
+	if err != nil {
+		log.Println("[email_cycle] Failed to parse cycle_start timestamp:", err)
+		ParseErrors.WithLabelValues("email_cycle", "cycle_start").Inc()
+	} else if endTime.After(startTime) {
+		c.sendPace(ch, data, startTime, endTime, clock)
+	}
+	if average, ok := c.history.dailyAverage(); ok {
+		ch <- prometheus.MustNewConstMetric(c.previousDaily, prometheus.GaugeValue, average)
 	}
+}
 
-	c.used.Collect(ch)
-	c.remaining.Collect(ch)
-	c.max.Collect(ch)
-	c.remainingSeconds.Collect(ch)
+// sendPace compares the usage with the ideal linear pace of the cycle, and
+// records it in the history.
+func (c *EmailCycleCollector) sendPace(ch chan<- prometheus.Metric, data EmailCycleData, start, end, clock time.Time) {
+	elapsed := min(max(clock.Sub(start).Seconds()/end.Sub(start).Seconds(), 0), 1)
+	if data.CycleMax.Valid {
+		ideal := data.CycleMax.Value * elapsed
+		ch <- prometheus.MustNewConstMetric(c.idealUsed, prometheus.GaugeValue, ideal)
+		if data.CycleUsed.Valid {
+			ch <- prometheus.MustNewConstMetric(c.usedOverIdeal, prometheus.GaugeValue, data.CycleUsed.Value-ideal)
+		}
+	}
+	if data.CycleUsed.Valid {
+		c.history.observe(start, end, data.CycleUsed.Value, clock)
+	}
 }
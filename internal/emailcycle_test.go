@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestEmailCycleCollector(t *testing.T) {
+	setNow(t, testNow)
+	server, client := newTestServer(t)
+
+	values := collectValues(t, NewEmailCycleCollector(client))
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_cycle_used":                                  522,
+		"smtp2go_email_cycle_remaining":                             478,
+		"smtp2go_email_cycle_max":                                   1000,
+		"smtp2go_email_cycle_remaining_seconds":                     8.5 * 24 * 3600,
+		"smtp2go_email_cycle_daily_budget":                          478 / 9.0,
+		"smtp2go_email_cycle_ideal_used":                            725.8064516129033,
+		"smtp2go_email_cycle_used_over_ideal":                       -203.8064516129033,
+		`smtp2go_scrape_collector_success{collector="email_cycle"}`: 1,
+	})
+
+	requests := server.Requests()
+	if len(requests) != 1 || requests[0].Path != "/stats/email_cycle" || requests[0].APIKey != "test-key" {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+}
+
+func TestEmailCycleCollectorPreviousCycles(t *testing.T) {
+	setNow(t, testNow)
+	server, _ := newTestServer(t)
+	stateDir := t.TempDir()
+	client := NewClient(ClientOptions{APIURL: server.URL, APIKey: "test-key", StateDir: stateDir})
+
+	values := collectValues(t, NewEmailCycleCollector(client))
+	if _, ok := values["smtp2go_email_cycle_previous_daily_average"]; ok {
+		t.Error("previous daily average without previous cycles")
+	}
+
+	setNow(t, time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC))
+	server.SetBody("/stats/email_cycle", `{"data":{"cycle_start":"2025-02-01 00:00:00+00:00","cycle_end":"2025-03-01 00:00:00+00:00","cycle_used":10,"cycle_remaining":990,"cycle_max":1000}}`)
+	values = collectValues(t, NewEmailCycleCollector(client))
+	// The previous cycle was last observed on January 23 at noon.
+	if got := values["smtp2go_email_cycle_previous_daily_average"]; got != 522.0/22.5 {
+		t.Errorf("previous daily average = %v, want %v", got, 522.0/22.5)
+	}
+	if got := values["smtp2go_email_cycle_ideal_used"]; got != 1000.0/28 {
+		t.Errorf("ideal used = %v, want %v", got, 1000.0/28)
+	}
+}
+
+func TestEmailCycleCollectorTimestampFormats(t *testing.T) {
+	setNow(t, testNow)
+	server, client := newTestServer(t)
+	collector := NewEmailCycleCollector(client)
+
+	for _, end := range []string{
+		"2025-02-01 00:00:00+00:00",
+		"2025-02-01 00:00:00Z",
+		"2025-02-01T00:00:00.000Z",
+		"2025-02-01T01:00:00+01:00",
+	} {
+		server.SetBody("/stats/email_cycle", `{"data":{"cycle_end":"`+end+`","cycle_used":1,"cycle_remaining":2,"cycle_max":3}}`)
+		values := collectValues(t, collector)
+		if got := values["smtp2go_email_cycle_remaining_seconds"]; got != 8.5*24*3600 {
+			t.Errorf("cycle_end %q: remaining_seconds = %v", end, got)
+		}
+	}
+}
+
+func TestEmailCycleCollectorBadTimestamp(t *testing.T) {
+	setNow(t, testNow)
+	server, client := newTestServer(t)
+	collector := NewEmailCycleCollector(client)
+	errors := ParseErrors.WithLabelValues("email_cycle", "cycle_end")
+	before := testutil.ToFloat64(errors)
+
+	// A first good scrape, so that a stale value would be available.
+	collectValues(t, collector)
+
+	server.SetBody("/stats/email_cycle", `{"data":{"cycle_end":"next tuesday","cycle_used":"522","cycle_remaining":478,"cycle_max":1000}}`)
+	values := collectValues(t, collector)
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_cycle_used":                                  522,
+		"smtp2go_email_cycle_remaining":                             478,
+		"smtp2go_email_cycle_max":                                   1000,
+		`smtp2go_scrape_collector_success{collector="email_cycle"}`: 1,
+	})
+	if got := testutil.ToFloat64(errors) - before; got != 1 {
+		t.Errorf("parse errors increased by %v, want 1", got)
+	}
+}
+
+func TestEmailCycleCollectorFailures(t *testing.T) {
+	for name, resp := range map[string]smtp2gotest.Response{
+		"unauthorized": smtp2gotest.Error(http.StatusUnauthorized),
+		"malformed":    smtp2gotest.Malformed(),
+		"slow":         {Body: smtp2gotest.EmailCycleBody, Latency: time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server, _ := newTestServer(t)
+			client := NewClient(ClientOptions{APIURL: server.URL, APIKey: "test-key", Timeout: 200 * time.Millisecond})
+			server.SetResponse("/stats/email_cycle", resp)
+
+			values := collectValues(t, NewEmailCycleCollector(client))
+			assertValues(t, values, map[string]float64{
+				`smtp2go_scrape_collector_success{collector="email_cycle"}`: 0,
+			})
+		})
+	}
+}
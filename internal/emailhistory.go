@@ -15,144 +15,619 @@
 package internal
 
 import (
+	"cmp"
 	"encoding/json"
+	"fmt"
 	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type EmailHistoryEntry struct {
-	Used         float64 `json:"used"`
-	ByteCount    float64 `json:"bytecount"`
-	AvgSize      float64 `json:"avgsize"`
-	EmailAddress string  `json:"email_address"`
-	Bounces      float64 `json:"bounces"`
-	Clicks       float64 `json:"clicks"`
-	Opens        float64 `json:"opens"`
-	Rejects      float64 `json:"rejects"`
-	Spam         float64 `json:"spam"`
-	Unsubscribes float64 `json:"unsubscribes"`
+	Used         Number `json:"used"`
+	ByteCount    Number `json:"bytecount"`
+	AvgSize      Number `json:"avgsize"`
+	EmailAddress string `json:"email_address"`
+	Bounces      Number `json:"bounces"`
+	Clicks       Number `json:"clicks"`
+	Opens        Number `json:"opens"`
+	Rejects      Number `json:"rejects"`
+	Spam         Number `json:"spam"`
+	Unsubscribes Number `json:"unsubscribes"`
+}
+
+// Values returns the numeric fields of the entry, keyed by their JSON name.
+func (e EmailHistoryEntry) Values() map[string]Number {
+	return map[string]Number{
+		"used":         e.Used,
+		"bytecount":    e.ByteCount,
+		"avgsize":      e.AvgSize,
+		"bounces":      e.Bounces,
+		"clicks":       e.Clicks,
+		"opens":        e.Opens,
+		"rejects":      e.Rejects,
+		"spam":         e.Spam,
+		"unsubscribes": e.Unsubscribes,
+	}
 }
 
 type EmailHistoryResponse struct {
 	RequestID string `json:"request_id"`
 	Data      struct {
 		History []EmailHistoryEntry `json:"history"`
-		Count   int                 `json:"count"`
+		Count   Number              `json:"count"`
 	} `json:"data"`
 }
 
+// OtherAddress is the email address label of the sum of the addresses left
+// out by the top limit of the email_history collector.
+const OtherAddress = "__other__"
+
+// Series of the email_history collector.
+const (
+	SeriesAddress = "address"
+	SeriesDomain  = "domain"
+)
+
+// Groupings of the email history.
+const (
+	GroupByEmailAddress    = "email_address"
+	GroupByUsername        = "username"
+	GroupBySubaccount      = "subaccount"
+	GroupByRecipientDomain = "recipient_domain"
+)
+
+// historyGroupings describe the groupings of the email history in help
+// texts.
+var historyGroupings = map[string]string{
+	GroupByEmailAddress:    "email address",
+	GroupByUsername:        "SMTP username",
+	GroupBySubaccount:      "subaccount",
+	GroupByRecipientDomain: "recipient domain",
+}
+
+// EmailHistoryConfig holds the settings of the email_history collector.
+type EmailHistoryConfig struct {
+	// GroupBy lists the groupings of the email history to fetch, each
+	// exported as its own metric family. Defaults to GroupByEmailAddress.
+	GroupBy []string `yaml:"group_by"`
+	// Series lists the series exported for the email address grouping: per
+	// email address (the default) and/or per sender domain.
+	Series []string `yaml:"series"`
+	// Include and Exclude are regular expressions matched against email
+	// addresses, or the values of the other groupings. When Include is set,
+	// only the values matching one of them are exported; values matching
+	// Exclude are never exported.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	// Top limits the exported values of each grouping to the ones which
+	// sent the most emails, the others being summed up as OtherAddress. 0
+	// means no limit.
+	Top int `yaml:"top"`
+	// Privacy pseudonymises the exported email addresses, and the values of
+	// the other groupings.
+	Privacy PrivacyConfig `yaml:"privacy"`
+	// PageSize is the number of rows requested at once, 1000 by default;
+	// MaxPages limits the requests made per scrape, 10 by default.
+	PageSize int `yaml:"page_size"`
+	MaxPages int `yaml:"max_pages"`
+}
+
+// Validate checks the groupings, the series, the regular expressions and the
+// limits.
+func (c EmailHistoryConfig) Validate() error {
+	for _, grouping := range c.GroupBy {
+		if _, ok := historyGroupings[grouping]; !ok {
+			return fmt.Errorf("email_history: unknown grouping %q", grouping)
+		}
+	}
+	if len(c.Series) > 0 && !c.groupedBy(GroupByEmailAddress) {
+		return fmt.Errorf("email_history: series need the %s grouping", GroupByEmailAddress)
+	}
+	for _, series := range c.Series {
+		if series != SeriesAddress && series != SeriesDomain {
+			return fmt.Errorf("email_history: unknown series %q", series)
+		}
+	}
+	for _, expr := range append(append([]string{}, c.Include...), c.Exclude...) {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("email_history: %w", err)
+		}
+	}
+	if c.Top < 0 || c.PageSize < 0 || c.MaxPages < 0 {
+		return fmt.Errorf("email_history: top, page_size and max_pages must not be negative")
+	}
+	return c.Privacy.Validate()
+}
+
+// groupedBy reports whether the email history is fetched with the grouping.
+func (c EmailHistoryConfig) groupedBy(grouping string) bool {
+	if len(c.GroupBy) == 0 {
+		return grouping == GroupByEmailAddress
+	}
+	return slices.Contains(c.GroupBy, grouping)
+}
+
+// historyFields are the fields of the email history, with the beginning of
+// their help text.
+var historyFields = []struct {
+	name string
+	help string
+}{
+	{"used", "Number of emails used"},
+	{"bytecount", "Total size in bytes of emails sent"},
+	{"avgsize", "Average size of emails"},
+	{"bounces", "Number of bounces"},
+	{"clicks", "Number of clicks"},
+	{"opens", "Number of opens"},
+	{"rejects", "Number of rejected emails"},
+	{"spam", "Number of spam reports"},
+	{"unsubscribes", "Number of unsubscribes"},
+}
+
+// historyRatios are the ratios derived from the fields of the email history,
+// keyed by metric name, relative to the number of emails used.
+var historyRatios = []struct {
+	name  string
+	field string
+	help  string
+}{
+	{"bounce_ratio", "bounces", "Ratio of bounces to emails used"},
+	{"spam_ratio", "spam", "Ratio of spam reports to emails used"},
+	{"open_ratio", "opens", "Ratio of opens to emails used"},
+	{"click_ratio", "clicks", "Ratio of clicks to emails used"},
+	{"unsubscribe_ratio", "unsubscribes", "Ratio of unsubscribes to emails used"},
+	{"reject_ratio", "rejects", "Ratio of rejected emails to emails used"},
+}
+
+// newHistoryMetrics describes the fields of the email history and their
+// ratios per label, keyed by field or ratio name.
+func newHistoryMetrics(ns, label, subject string) map[string]Metric {
+	metrics := map[string]Metric{}
+	for _, field := range historyFields {
+		metrics[field.name] = Metric{
+			Name:   prometheus.BuildFQName(ns, "", field.name),
+			Help:   field.help + " per " + subject,
+			Labels: []string{label},
+		}
+	}
+	for _, ratio := range historyRatios {
+		metrics[ratio.name] = Metric{
+			Name:   prometheus.BuildFQName(ns, "", ratio.name),
+			Help:   ratio.help + " per " + subject,
+			Labels: []string{label},
+		}
+	}
+	return metrics
+}
+
+// newDomainMetrics describes the email history per sender domain.
+func newDomainMetrics(ns string) map[string]Metric {
+	return newHistoryMetrics(prometheus.BuildFQName(ns, "", "domain"), "domain", "sender domain")
+}
+
+// newHistoryDescs returns the descriptors of metrics, with the same keys.
+func newHistoryDescs(metrics map[string]Metric) map[string]*prometheus.Desc {
+	descs := map[string]*prometheus.Desc{}
+	for key, metric := range metrics {
+		descs[key] = metric.desc(nil)
+	}
+	return descs
+}
+
 type EmailHistoryCollector struct {
 	mutex     sync.Mutex
-	apiURL    string
-	apiKey    string
-	debug     bool
+	client    *Client
 	namespace string
+	include   []*regexp.Regexp
+	exclude   []*regexp.Regexp
+	top       int
+	pageSize  int
+	maxPages  int
+	// pseudonymizer is nil when addresses are exported as is.
+	pseudonymizer *Pseudonymizer
 
-	metrics map[string]*prometheus.GaugeVec
+	groupings []*historyGrouping
+	// domains is nil when the domain series are disabled.
+	domains map[string]*prometheus.Desc
+	success *prometheus.Desc
 }
 
-func NewEmailHistoryCollector(apiURL, apiKey string, debug bool) *EmailHistoryCollector {
-	ns := "smtp2go_email_history"
+// historyGrouping is a grouping of the email history and its metrics.
+type historyGrouping struct {
+	name string
+	// descs is nil when the rows are not exported on their own.
+	descs     map[string]*prometheus.Desc
+	truncated *prometheus.Desc
+	dropped   *prometheus.Desc
+}
 
-	labels := []string{"email_address"}
+// newGroupingMetrics describes the metrics of a grouping of the email
+// history: those of its rows, keyed by field or ratio name, whether it is
+// truncated and how many rows were dropped.
+func newGroupingMetrics(ns, name string) (rows map[string]Metric, truncated, dropped Metric) {
+	subject := historyGroupings[name]
+	// The email addresses keep the names they had before the groupings.
+	droppedName := "dropped_addresses"
+	if name != GroupByEmailAddress {
+		ns = prometheus.BuildFQName(ns, "", name)
+		droppedName = "dropped"
+	}
+	plural := subject + "s"
+	if strings.HasSuffix(subject, "s") {
+		plural = subject + "es"
+	}
+	truncated = Metric{
+		Name: prometheus.BuildFQName(ns, "", "truncated"),
+		Help: "Whether fewer rows of email history were collected than counted by the API",
+	}
+	dropped = Metric{
+		Name:   prometheus.BuildFQName(ns, "", droppedName),
+		Help:   "Number of " + plural + " not exported on their own, either excluded or aggregated as " + OtherAddress,
+		Labels: []string{"reason"},
+	}
+	return newHistoryMetrics(ns, name, subject), truncated, dropped
+}
+
+func newHistoryGrouping(ns, name string) *historyGrouping {
+	rows, truncated, dropped := newGroupingMetrics(ns, name)
+	return &historyGrouping{
+		name:      name,
+		descs:     newHistoryDescs(rows),
+		truncated: truncated.desc(nil),
+		dropped:   dropped.desc(nil),
+	}
+}
 
-	return &EmailHistoryCollector{
-		apiURL:    apiURL,
-		apiKey:    apiKey,
-		debug:     debug,
+// NewEmailHistoryCollector creates the email_history collector, exporting
+// addresses through pseudonymizer if not nil. The configuration is expected
+// to be valid.
+func NewEmailHistoryCollector(client *Client, cfg EmailHistoryConfig, pseudonymizer *Pseudonymizer) *EmailHistoryCollector {
+	ns := "smtp2go_email_history"
+
+	c := &EmailHistoryCollector{
+		client:    client,
 		namespace: ns,
-		metrics: map[string]*prometheus.GaugeVec{
-			"used": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "used",
-				Help:      "Number of emails used per email address",
-			}, labels),
-			"bytecount": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "bytecount",
-				Help:      "Total size in bytes of emails sent per email address",
-			}, labels),
-			"avgsize": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "avgsize",
-				Help:      "Average size of emails per email address",
-			}, labels),
-			"bounces": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "bounces",
-				Help:      "Number of bounces per email address",
-			}, labels),
-			"clicks": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "clicks",
-				Help:      "Number of clicks per email address",
-			}, labels),
-			"opens": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "opens",
-				Help:      "Number of opens per email address",
-			}, labels),
-			"rejects": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "rejects",
-				Help:      "Number of rejected emails per email address",
-			}, labels),
-			"spam": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "spam",
-				Help:      "Number of spam reports per email address",
-			}, labels),
-			"unsubscribes": prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: ns,
-				Name:      "unsubscribes",
-				Help:      "Number of unsubscribes per email address",
-			}, labels),
-		},
+		include:   mustCompileAll(cfg.Include),
+		exclude:   mustCompileAll(cfg.Exclude),
+		top:       cfg.Top,
+		pageSize:  cmp.Or(cfg.PageSize, 1000),
+		maxPages:  cmp.Or(cfg.MaxPages, 10),
+
+		pseudonymizer: pseudonymizer,
+		success:       newSuccessDesc("email_history"),
 	}
+	for name := range historyGroupings {
+		if !cfg.groupedBy(name) {
+			continue
+		}
+		grouping := newHistoryGrouping(ns, name)
+		if name == GroupByEmailAddress && len(cfg.Series) > 0 && !slices.Contains(cfg.Series, SeriesAddress) {
+			grouping.descs = nil
+		}
+		c.groupings = append(c.groupings, grouping)
+	}
+	sort.Slice(c.groupings, func(i, j int) bool { return c.groupings[i].name < c.groupings[j].name })
+	if slices.Contains(cfg.Series, SeriesDomain) {
+		c.domains = newHistoryDescs(newDomainMetrics(ns))
+	}
+	return c
+}
+
+func mustCompileAll(exprs []string) []*regexp.Regexp {
+	var regexps []*regexp.Regexp
+	for _, expr := range exprs {
+		regexps = append(regexps, regexp.MustCompile(expr))
+	}
+	return regexps
+}
+
+// metrics lists the metrics of the collector, as described by Describe.
+func (c *EmailHistoryCollector) metrics() []Metric {
+	var metrics []Metric
+	for _, grouping := range c.groupings {
+		rows, truncated, dropped := newGroupingMetrics(c.namespace, grouping.name)
+		if grouping.descs != nil {
+			metrics = slices.AppendSeq(metrics, maps.Values(rows))
+		}
+		metrics = append(metrics, truncated, dropped)
+	}
+	if c.domains != nil {
+		metrics = slices.AppendSeq(metrics, maps.Values(newDomainMetrics(c.namespace)))
+	}
+	return append(metrics, successMetric)
 }
 
 func (c *EmailHistoryCollector) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range c.metrics {
-		metric.Describe(ch)
+	for _, grouping := range c.groupings {
+		for _, desc := range grouping.descs {
+			ch <- desc
+		}
+		ch <- grouping.truncated
+		ch <- grouping.dropped
+	}
+	for _, desc := range c.domains {
+		ch <- desc
 	}
+	ch <- c.success
 }
 
 func (c *EmailHistoryCollector) Collect(ch chan<- prometheus.Metric) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	body, err := doPostRequest(c.apiURL, "/stats/email_history", c.apiKey, c.debug, "email_history")
-	if err != nil {
+	success := true
+	for _, grouping := range c.groupings {
+		history, count, truncated, err := c.fetch(grouping.name)
+		if err != nil {
+			success = false
+			continue
+		}
+
+		if checkNumber("email_history", "count", count) {
+			value := 0.0
+			if truncated {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(grouping.truncated, prometheus.GaugeValue, value)
+		}
+
+		c.collectGrouping(ch, grouping, history)
+	}
+	sendSuccess(ch, c.success, success)
+}
+
+// collectGrouping exports the history of a grouping, applying the filters,
+// limit and pseudonyms, along with the domain series of the email address
+// grouping.
+func (c *EmailHistoryCollector) collectGrouping(ch chan<- prometheus.Metric, grouping *historyGrouping, history []EmailHistoryEntry) {
+	entries := c.filter(history)
+	excluded := len(history) - len(entries)
+	ch <- prometheus.MustNewConstMetric(grouping.dropped, prometheus.GaugeValue, float64(excluded), "excluded")
+
+	if grouping.name == GroupByEmailAddress && c.domains != nil {
+		for _, entry := range byDomain(entries) {
+			c.send(ch, c.domains, entry)
+		}
+	}
+
+	entries, aggregated := c.limit(entries)
+	ch <- prometheus.MustNewConstMetric(grouping.dropped, prometheus.GaugeValue, float64(aggregated), "aggregated")
+	if grouping.descs == nil {
 		return
 	}
+	if c.pseudonymizer != nil {
+		entries = c.pseudonymize(entries)
+	}
+	for _, entry := range entries {
+		c.send(ch, grouping.descs, entry)
+	}
+}
+
+// fetch pages through the email history with the given grouping, until as
+// many rows as counted by the API are received, a page is incomplete or only
+// repeats known rows, or the page limit is reached. It returns the rows,
+// whose EmailAddress holds the value they are grouped by, the count of the
+// last page and whether the history is truncated: fewer rows than counted
+// were received, or paging stopped on a failed page or one that only repeats
+// known rows. It fails only if the first page does.
+func (c *EmailHistoryCollector) fetch(grouping string) ([]EmailHistoryEntry, Number, bool, error) {
+	var (
+		history   []EmailHistoryEntry
+		received  int
+		count     Number
+		truncated bool
+	)
+	seen := map[string]bool{}
+	for page := 0; page < c.maxPages; page++ {
+		params := map[string]any{
+			"limit":  c.pageSize,
+			"offset": received,
+		}
+		if grouping != GroupByEmailAddress {
+			params["group_by"] = grouping
+		}
+		body, err := c.client.FetchParams("/stats/email_history", "email_history", params)
+		var (
+			entries []EmailHistoryEntry
+			rows    int
+		)
+		if err == nil {
+			if entries, rows, count, err = parseHistory(body, grouping); err != nil {
+				log.Println("[email_history] Failed to parse JSON:", err)
+			}
+		}
+		if err != nil {
+			if page == 0 {
+				return nil, count, false, err
+			}
+			log.Printf("[email_history] Failed to fetch page %d, history truncated: %v", page+1, err)
+			truncated = true
+			break
+		}
+
+		received += rows
+		added := 0
+		for _, entry := range entries {
+			if !seen[entry.EmailAddress] {
+				seen[entry.EmailAddress] = true
+				history = append(history, entry)
+				added++
+			}
+		}
+		if added == 0 && rows > 0 {
+			// The API ignored the offset: later pages would repeat this one.
+			truncated = true
+			break
+		}
+		if rows < c.pageSize || (count.Valid && float64(received) >= count.Value) {
+			break
+		}
+	}
+	return history, count, truncated || float64(received) < count.Value, nil
+}
 
+// parseHistory decodes a page of email history, replacing the email address
+// of the rows by the value of their grouping, and returns them along with
+// the number of rows on the page and the count. Rows without a value are
+// counted as parse errors and left out.
+func parseHistory(body []byte, grouping string) ([]EmailHistoryEntry, int, Number, error) {
 	var apiResp EmailHistoryResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		log.Println("[email_history] Failed to parse JSON:", err)
+		return nil, 0, Number{}, err
+	}
+	entries := apiResp.Data.History
+	if grouping == GroupByEmailAddress {
+		return entries, len(entries), apiResp.Data.Count, nil
+	}
+
+	var rows struct {
+		Data struct {
+			History []map[string]any `json:"history"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, 0, Number{}, err
+	}
+	var grouped []EmailHistoryEntry
+	for i, row := range rows.Data.History {
+		key, ok := row[grouping].(string)
+		if !ok || key == "" {
+			log.Printf("[email_history] Row without %s: %v", grouping, row)
+			ParseErrors.WithLabelValues("email_history", grouping).Inc()
+			continue
+		}
+		entries[i].EmailAddress = key
+		grouped = append(grouped, entries[i])
+	}
+	return grouped, len(entries), apiResp.Data.Count, nil
+}
+
+// send exports the fields of entry and their ratios, labelled with its email
+// address or the value it is grouped by. Ratios are left out when no email
+// was used.
+func (c *EmailHistoryCollector) send(ch chan<- prometheus.Metric, descs map[string]*prometheus.Desc, entry EmailHistoryEntry) {
+	values := entry.Values()
+	for name, value := range values {
+		sendNumber(ch, descs[name], "email_history", name, value, entry.EmailAddress)
+	}
+
+	if !entry.Used.Valid || entry.Used.Value <= 0 {
 		return
 	}
+	for _, ratio := range historyRatios {
+		if value := values[ratio.field]; value.Valid {
+			ch <- prometheus.MustNewConstMetric(descs[ratio.name], prometheus.GaugeValue, value.Value/entry.Used.Value, entry.EmailAddress)
+		}
+	}
+}
+
+// filter returns the entries matching the include and exclude expressions.
+func (c *EmailHistoryCollector) filter(history []EmailHistoryEntry) []EmailHistoryEntry {
+	matches := func(regexps []*regexp.Regexp, address string) bool {
+		for _, re := range regexps {
+			if re.MatchString(address) {
+				return true
+			}
+		}
+		return false
+	}
 
-	// Reset metrics to remove outdated labels
-	for _, metric := range c.metrics {
-		metric.Reset()
+	var entries []EmailHistoryEntry
+	for _, entry := range history {
+		if (len(c.include) > 0 && !matches(c.include, entry.EmailAddress)) || matches(c.exclude, entry.EmailAddress) {
+			continue
+		}
+		entries = append(entries, entry)
 	}
+	return entries
+}
 
-	for _, entry := range apiResp.Data.History {
-		labels := prometheus.Labels{"email_address": entry.EmailAddress}
-		c.metrics["used"].With(labels).Set(entry.Used)
-		c.metrics["bytecount"].With(labels).Set(entry.ByteCount)
-		c.metrics["avgsize"].With(labels).Set(entry.AvgSize)
-		c.metrics["bounces"].With(labels).Set(entry.Bounces)
-		c.metrics["clicks"].With(labels).Set(entry.Clicks)
-		c.metrics["opens"].With(labels).Set(entry.Opens)
-		c.metrics["rejects"].With(labels).Set(entry.Rejects)
-		c.metrics["spam"].With(labels).Set(entry.Spam)
-		c.metrics["unsubscribes"].With(labels).Set(entry.Unsubscribes)
+// limit sums up the entries beyond the top limit, returning the entries to
+// export along with the number of aggregated addresses.
+func (c *EmailHistoryCollector) limit(entries []EmailHistoryEntry) ([]EmailHistoryEntry, int) {
+	if c.top == 0 || len(entries) <= c.top {
+		return entries, 0
 	}
 
-	for _, metric := range c.metrics {
-		metric.Collect(ch)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Used.Value != entries[j].Used.Value {
+			return entries[i].Used.Value > entries[j].Used.Value
+		}
+		return entries[i].EmailAddress < entries[j].EmailAddress
+	})
+	rest := entries[c.top:]
+	return append(entries[:c.top:c.top], sumEntries(OtherAddress, rest)), len(rest)
+}
+
+// pseudonymize replaces the addresses of entries by their pseudonyms,
+// summing up the entries sharing one.
+func (c *EmailHistoryCollector) pseudonymize(entries []EmailHistoryEntry) []EmailHistoryEntry {
+	groups := map[string][]EmailHistoryEntry{}
+	var pseudonyms []string
+	for _, entry := range entries {
+		if entry.EmailAddress != OtherAddress {
+			entry.EmailAddress = c.pseudonymizer.Pseudonymize(entry.EmailAddress)
+		}
+		if _, ok := groups[entry.EmailAddress]; !ok {
+			pseudonyms = append(pseudonyms, entry.EmailAddress)
+		}
+		groups[entry.EmailAddress] = append(groups[entry.EmailAddress], entry)
+	}
+
+	var result []EmailHistoryEntry
+	for _, pseudonym := range pseudonyms {
+		if group := groups[pseudonym]; len(group) == 1 {
+			result = append(result, group[0])
+		} else {
+			result = append(result, sumEntries(pseudonym, group))
+		}
+	}
+	return result
+}
+
+// byDomain sums up the entries per sender domain, returned in place of their
+// email address.
+func byDomain(entries []EmailHistoryEntry) []EmailHistoryEntry {
+	groups := map[string][]EmailHistoryEntry{}
+	var domains []string
+	for _, entry := range entries {
+		domain := strings.ToLower(entry.EmailAddress[strings.LastIndex(entry.EmailAddress, "@")+1:])
+		if _, ok := groups[domain]; !ok {
+			domains = append(domains, domain)
+		}
+		groups[domain] = append(groups[domain], entry)
+	}
+
+	var sums []EmailHistoryEntry
+	for _, domain := range domains {
+		sums = append(sums, sumEntries(domain, groups[domain]))
+	}
+	return sums
+}
+
+// sumEntries sums up entries under the given address, computing the average
+// size of the emails from the totals.
+func sumEntries(address string, entries []EmailHistoryEntry) EmailHistoryEntry {
+	sum := EmailHistoryEntry{EmailAddress: address}
+	for _, entry := range entries {
+		sum.Used = sum.Used.add(entry.Used)
+		sum.ByteCount = sum.ByteCount.add(entry.ByteCount)
+		sum.Bounces = sum.Bounces.add(entry.Bounces)
+		sum.Clicks = sum.Clicks.add(entry.Clicks)
+		sum.Opens = sum.Opens.add(entry.Opens)
+		sum.Rejects = sum.Rejects.add(entry.Rejects)
+		sum.Spam = sum.Spam.add(entry.Spam)
+		sum.Unsubscribes = sum.Unsubscribes.add(entry.Unsubscribes)
+	}
+	if sum.Used.Valid && sum.Used.Value > 0 && sum.ByteCount.Valid {
+		sum.AvgSize = Number{Value: sum.ByteCount.Value / sum.Used.Value, Valid: true}
 	}
+	return sum
 }
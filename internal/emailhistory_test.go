@@ -0,0 +1,295 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestEmailHistoryCollector(t *testing.T) {
+	_, client := newTestServer(t)
+
+	values := collectValues(t, NewEmailHistoryCollector(client, EmailHistoryConfig{}, nil))
+	assertValues(t, values, map[string]float64{
+		`smtp2go_email_history_used{email_address="alice@example.tld"}`:              407,
+		`smtp2go_email_history_bytecount{email_address="alice@example.tld"}`:         3001238,
+		`smtp2go_email_history_avgsize{email_address="alice@example.tld"}`:           7374.04914004914,
+		`smtp2go_email_history_bounces{email_address="alice@example.tld"}`:           2,
+		`smtp2go_email_history_clicks{email_address="alice@example.tld"}`:            10,
+		`smtp2go_email_history_opens{email_address="alice@example.tld"}`:             120,
+		`smtp2go_email_history_rejects{email_address="alice@example.tld"}`:           1,
+		`smtp2go_email_history_spam{email_address="alice@example.tld"}`:              0,
+		`smtp2go_email_history_unsubscribes{email_address="alice@example.tld"}`:      3,
+		`smtp2go_email_history_used{email_address="bob@example.tld"}`:                7,
+		`smtp2go_email_history_bytecount{email_address="bob@example.tld"}`:           143384,
+		`smtp2go_email_history_avgsize{email_address="bob@example.tld"}`:             20483.428571428572,
+		`smtp2go_email_history_bounces{email_address="bob@example.tld"}`:             0,
+		`smtp2go_email_history_clicks{email_address="bob@example.tld"}`:              0,
+		`smtp2go_email_history_opens{email_address="bob@example.tld"}`:               1,
+		`smtp2go_email_history_rejects{email_address="bob@example.tld"}`:             0,
+		`smtp2go_email_history_spam{email_address="bob@example.tld"}`:                1,
+		`smtp2go_email_history_unsubscribes{email_address="bob@example.tld"}`:        0,
+		`smtp2go_email_history_bounce_ratio{email_address="alice@example.tld"}`:      2.0 / 407,
+		`smtp2go_email_history_spam_ratio{email_address="alice@example.tld"}`:        0,
+		`smtp2go_email_history_open_ratio{email_address="alice@example.tld"}`:        120.0 / 407,
+		`smtp2go_email_history_click_ratio{email_address="alice@example.tld"}`:       10.0 / 407,
+		`smtp2go_email_history_unsubscribe_ratio{email_address="alice@example.tld"}`: 3.0 / 407,
+		`smtp2go_email_history_reject_ratio{email_address="alice@example.tld"}`:      1.0 / 407,
+		`smtp2go_email_history_bounce_ratio{email_address="bob@example.tld"}`:        0,
+		`smtp2go_email_history_spam_ratio{email_address="bob@example.tld"}`:          1.0 / 7,
+		`smtp2go_email_history_open_ratio{email_address="bob@example.tld"}`:          1.0 / 7,
+		`smtp2go_email_history_click_ratio{email_address="bob@example.tld"}`:         0,
+		`smtp2go_email_history_unsubscribe_ratio{email_address="bob@example.tld"}`:   0,
+		`smtp2go_email_history_reject_ratio{email_address="bob@example.tld"}`:        0,
+		`smtp2go_email_history_truncated`:                                            0,
+		`smtp2go_email_history_dropped_addresses{reason="aggregated"}`:               0,
+		`smtp2go_email_history_dropped_addresses{reason="excluded"}`:                 0,
+		`smtp2go_scrape_collector_success{collector="email_history"}`:                1,
+	})
+}
+
+func TestEmailHistoryCollectorDropsVanishedAddresses(t *testing.T) {
+	server, client := newTestServer(t)
+	collector := NewEmailHistoryCollector(client, EmailHistoryConfig{}, nil)
+
+	collectValues(t, collector)
+	server.SetBody("/stats/email_history", `{"data":{"history":[{"email_address":"bob@example.tld","used":8,"bytecount":"oops"}],"count":1}}`)
+	values := collectValues(t, collector)
+	assertValues(t, values, map[string]float64{
+		`smtp2go_email_history_used{email_address="bob@example.tld"}`:  8,
+		`smtp2go_email_history_truncated`:                              0,
+		`smtp2go_email_history_dropped_addresses{reason="aggregated"}`: 0,
+		`smtp2go_email_history_dropped_addresses{reason="excluded"}`:   0,
+		`smtp2go_scrape_collector_success{collector="email_history"}`:  1,
+	})
+}
+
+func TestEmailHistoryCollectorMalformed(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetResponse("/stats/email_history", smtp2gotest.Malformed())
+
+	values := collectValues(t, NewEmailHistoryCollector(client, EmailHistoryConfig{}, nil))
+	assertValues(t, values, map[string]float64{
+		`smtp2go_scrape_collector_success{collector="email_history"}`: 0,
+	})
+}
+
+func TestEmailHistoryCollectorLimits(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetBody("/stats/email_history", `{"data":{"history":[
+		{"email_address":"alice@example.tld","used":40,"bytecount":4000},
+		{"email_address":"bob@example.tld","used":10,"bytecount":3000},
+		{"email_address":"carol@example.tld","used":30,"bytecount":1000},
+		{"email_address":"no-reply+a1b2@example.tld","used":50,"bytecount":500},
+		{"email_address":"dave@other.tld","used":20,"bytecount":2000}
+	],"count":5}}`)
+
+	collector := NewEmailHistoryCollector(client, EmailHistoryConfig{
+		Include: []string{`@example\.tld$`},
+		Exclude: []string{`^no-reply\+`},
+		Top:     1,
+	}, nil)
+	values := collectValues(t, collector)
+	for key, want := range map[string]float64{
+		`smtp2go_email_history_used{email_address="alice@example.tld"}`: 40,
+		`smtp2go_email_history_used{email_address="__other__"}`:         40,
+		`smtp2go_email_history_bytecount{email_address="__other__"}`:    4000,
+		`smtp2go_email_history_avgsize{email_address="__other__"}`:      100,
+		`smtp2go_email_history_dropped_addresses{reason="excluded"}`:    2,
+		`smtp2go_email_history_dropped_addresses{reason="aggregated"}`:  2,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	for key := range values {
+		if strings.Contains(key, "bob@") || strings.Contains(key, "no-reply") || strings.Contains(key, "dave@") {
+			t.Errorf("unexpected series %s", key)
+		}
+	}
+}
+
+func TestEmailHistoryCollectorDomains(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetBody("/stats/email_history", `{"data":{"history":[
+		{"email_address":"alice@example.tld","used":40,"bytecount":4000,"bounces":1},
+		{"email_address":"bob@Example.tld","used":10,"bytecount":6000,"bounces":"oops"},
+		{"email_address":"carol@other.tld","used":0,"bytecount":0}
+	],"count":3}}`)
+
+	collector := NewEmailHistoryCollector(client, EmailHistoryConfig{Series: []string{SeriesDomain}}, nil)
+	values := collectValues(t, collector)
+	for key, want := range map[string]float64{
+		`smtp2go_email_history_domain_used{domain="example.tld"}`:         50,
+		`smtp2go_email_history_domain_bytecount{domain="example.tld"}`:    10000,
+		`smtp2go_email_history_domain_avgsize{domain="example.tld"}`:      200,
+		`smtp2go_email_history_domain_bounces{domain="example.tld"}`:      1,
+		`smtp2go_email_history_domain_used{domain="other.tld"}`:           0,
+		`smtp2go_email_history_domain_bounce_ratio{domain="example.tld"}`: 0.02,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	for key := range values {
+		if strings.Contains(key, "email_address=") || (strings.Contains(key, `domain="other.tld"`) && !strings.Contains(key, "_used") && !strings.Contains(key, "_bytecount")) {
+			t.Errorf("unexpected series %s", key)
+		}
+	}
+}
+
+func TestEmailHistoryCollectorPages(t *testing.T) {
+	pageOf := func(count int, addresses ...string) smtp2gotest.Response {
+		var rows []string
+		for _, address := range addresses {
+			rows = append(rows, `{"email_address":"`+address+`","used":1}`)
+		}
+		return smtp2gotest.Response{Body: `{"data":{"history":[` + strings.Join(rows, ",") + `],"count":` + strconv.Itoa(count) + `}}`}
+	}
+	page := func(addresses ...string) smtp2gotest.Response {
+		return pageOf(5, addresses...)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		maxPages  int
+		pages     []smtp2gotest.Response
+		requests  int
+		rows      int
+		truncated float64
+	}{
+		{"complete", 0, []smtp2gotest.Response{page("a", "b"), page("c", "d"), page("e")}, 3, 5, 0},
+		{"page limit", 2, []smtp2gotest.Response{page("a", "b"), page("c", "d")}, 2, 4, 1},
+		{"repeated row", 0, []smtp2gotest.Response{page("a", "b"), page("b", "c"), page("d", "e")}, 3, 5, 0},
+		{"offset ignored", 0, []smtp2gotest.Response{page("a", "b"), page("a", "b")}, 2, 2, 1},
+		{"offset ignored, count reached", 0, []smtp2gotest.Response{pageOf(4, "a", "b"), pageOf(4, "a", "b")}, 2, 2, 1},
+		{"failed page", 0, []smtp2gotest.Response{page("a", "b"), smtp2gotest.Error(400)}, 2, 2, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := newTestServer(t)
+			server.Enqueue("/stats/email_history", tc.pages...)
+
+			collector := NewEmailHistoryCollector(client, EmailHistoryConfig{PageSize: 2, MaxPages: tc.maxPages}, nil)
+			values := collectValues(t, collector)
+			if got := values[`smtp2go_email_history_truncated`]; got != tc.truncated {
+				t.Errorf("truncated = %v, want %v", got, tc.truncated)
+			}
+			rows := 0
+			for key := range values {
+				if strings.HasPrefix(key, "smtp2go_email_history_used{") {
+					rows++
+				}
+			}
+			if rows != tc.rows {
+				t.Errorf("got %d rows, want %d", rows, tc.rows)
+			}
+
+			requests := server.Requests()
+			if len(requests) != tc.requests {
+				t.Fatalf("got %d requests, want %d", len(requests), tc.requests)
+			}
+			for i, req := range requests {
+				if req.Params["limit"] != 2.0 || req.Params["offset"] != float64(2*i) {
+					t.Errorf("request %d: unexpected parameters %v", i, req.Params)
+				}
+			}
+		})
+	}
+}
+
+func TestEmailHistoryCollectorGroupings(t *testing.T) {
+	server, client := newTestServer(t)
+	server.Enqueue("/stats/email_history",
+		smtp2gotest.Response{Body: `{"data":{"history":[{"email_address":"alice@example.tld","used":4}],"count":1}}`},
+		smtp2gotest.Response{Body: `{"data":{"history":[
+			{"username":"newsletter","used":40,"bounces":2},
+			{"used":1}
+		],"count":2}}`},
+	)
+
+	collector := NewEmailHistoryCollector(client, EmailHistoryConfig{
+		GroupBy: []string{GroupByUsername, GroupByEmailAddress},
+	}, nil)
+	errors := ParseErrors.WithLabelValues("email_history", GroupByUsername)
+	before := testutil.ToFloat64(errors)
+	values := collectValues(t, collector)
+	for key, want := range map[string]float64{
+		`smtp2go_email_history_used{email_address="alice@example.tld"}`:      4,
+		`smtp2go_email_history_username_used{username="newsletter"}`:         40,
+		`smtp2go_email_history_username_bounce_ratio{username="newsletter"}`: 0.05,
+		`smtp2go_email_history_username_truncated`:                           0,
+		`smtp2go_scrape_collector_success{collector="email_history"}`:        1,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(errors) - before; got != 1 {
+		t.Errorf("parse errors = %v, want 1", got)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if _, ok := requests[0].Params["group_by"]; ok {
+		t.Errorf("email_address request has parameters %v", requests[0].Params)
+	}
+	if got := requests[1].Params["group_by"]; got != GroupByUsername {
+		t.Errorf("group_by = %v, want %s", got, GroupByUsername)
+	}
+}
+
+func TestEmailHistoryCollectorGroupingsFiltered(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetBody("/stats/email_history", `{"data":{"history":[
+		{"username":"newsletter","used":40},
+		{"username":"news-eu","used":10},
+		{"username":"billing","used":5}
+	],"count":3}}`)
+	p, _ := NewPseudonymizer(PrivacyConfig{Mode: PrivacyMask})
+
+	collector := NewEmailHistoryCollector(client, EmailHistoryConfig{
+		GroupBy: []string{GroupByUsername},
+		Include: []string{"^news"},
+		Top:     1,
+	}, p)
+	values := collectValues(t, collector)
+	for key, want := range map[string]float64{
+		`smtp2go_email_history_username_used{username="n***"}`:        40,
+		`smtp2go_email_history_username_used{username="__other__"}`:   10,
+		`smtp2go_email_history_username_dropped{reason="excluded"}`:   1,
+		`smtp2go_email_history_username_dropped{reason="aggregated"}`: 1,
+		`smtp2go_email_history_username_truncated`:                    0,
+		`smtp2go_scrape_collector_success{collector="email_history"}`: 1,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	for key := range values {
+		if strings.Contains(key, "billing") || strings.Contains(key, "newsletter") {
+			t.Errorf("unexpected series %s", key)
+		}
+	}
+	if got := p.Lookup("n***"); len(got) != 1 || got[0] != "newsletter" {
+		t.Errorf("Lookup = %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestEmailSpamCollector(t *testing.T) {
+	_, client := newTestServer(t)
+
+	values := collectValues(t, NewEmailSpamCollector(client))
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_spam_emails":                                415,
+		"smtp2go_email_spam_rejects":                               108,
+		"smtp2go_email_spam_spams":                                 2,
+		"smtp2go_email_spam_spam_percent":                          0.5,
+		"smtp2go_email_spam_spam_ratio":                            0.005,
+		`smtp2go_scrape_collector_success{collector="email_spam"}`: 1,
+	})
+}
+
+func TestEmailSpamCollectorInvalidPercent(t *testing.T) {
+	server, client := newTestServer(t)
+	collector := NewEmailSpamCollector(client)
+	errors := ParseErrors.WithLabelValues("email_spam", "spam_percent")
+	before := testutil.ToFloat64(errors)
+
+	collectValues(t, collector)
+	server.SetBody("/stats/email_spam", `{"data":{"emails":415,"rejects":108,"spams":2,"spam_percent":"n/a"}}`)
+	values := collectValues(t, collector)
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_spam_emails":                                415,
+		"smtp2go_email_spam_rejects":                               108,
+		"smtp2go_email_spam_spams":                                 2,
+		`smtp2go_scrape_collector_success{collector="email_spam"}`: 1,
+	})
+	// The field backs two metrics but is only reported once.
+	if got := testutil.ToFloat64(errors) - before; got != 1 {
+		t.Errorf("parse errors increased by %v, want 1", got)
+	}
+}
+
+func TestEmailSpamCollectorMalformed(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetResponse("/stats/email_spam", smtp2gotest.Malformed())
+
+	values := collectValues(t, NewEmailSpamCollector(client))
+	assertValues(t, values, map[string]float64{
+		`smtp2go_scrape_collector_success{collector="email_spam"}`: 0,
+	})
+}
@@ -14,20 +14,11 @@
 
 package internal
 
-import (
-	"encoding/json"
-	"log"
-	"strconv"
-	"sync"
-
-	"github.com/prometheus/client_golang/prometheus"
-)
-
 type EmailUnsubsData struct {
-	Emails             float64 `json:"emails"`
-	Rejects            float64 `json:"rejects"`
-	Unsubscribes       float64 `json:"unsubscribes"`
-	UnsubscribePercent string  `json:"unsubscribe_percent"`
+	Emails             Number `json:"emails"`
+	Rejects            Number `json:"rejects"`
+	Unsubscribes       Number `json:"unsubscribes"`
+	UnsubscribePercent Number `json:"unsubscribe_percent"`
 }
 
 type EmailUnsubsResponse struct {
@@ -35,86 +26,17 @@ type EmailUnsubsResponse struct {
 	Data      EmailUnsubsData `json:"data"`
 }
 
-type EmailUnsubsCollector struct {
-	mutex     sync.Mutex
-	apiURL    string
-	apiKey    string
-	debug     bool
-	namespace string
-
-	emails             prometheus.Gauge
-	rejects            prometheus.Gauge
-	unsubscribes       prometheus.Gauge
-	unsubscribePercent prometheus.Gauge
+var EmailUnsubsEndpoint = EndpointDescriptor{
+	Name: "email_unsubs",
+	Fields: []FieldDescriptor{
+		{Field: "emails", Help: "Number of emails processed"},
+		{Field: "rejects", Help: "Number of rejected emails"},
+		{Field: "unsubscribes", Help: "Number of unsubscribes"},
+		{Field: "unsubscribe_percent", Help: "Percentage of unsubscribes"},
+		{Field: "unsubscribe_percent", Name: "unsubscribe_ratio", Help: "Ratio of unsubscribes, between 0 and 1", Parse: ParseRatio},
+	},
 }
 
-func NewEmailUnsubsCollector(apiURL, apiKey string, debug bool) *EmailUnsubsCollector {
-	ns := "smtp2go_email_unsubs"
-
-	return &EmailUnsubsCollector{
-		apiURL:    apiURL,
-		apiKey:    apiKey,
-		debug:     debug,
-		namespace: ns,
-		emails: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "emails",
-			Help:      "Number of emails processed",
-		}),
-		rejects: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "rejects",
-			Help:      "Number of rejected emails",
-		}),
-		unsubscribes: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "unsubscribes",
-			Help:      "Number of unsubscribes",
-		}),
-		unsubscribePercent: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: ns,
-			Name:      "unsubscribe_percent",
-			Help:      "Percentage of unsubscribes",
-		}),
-	}
-}
-
-func (c *EmailUnsubsCollector) Describe(ch chan<- *prometheus.Desc) {
-	c.emails.Describe(ch)
-	c.rejects.Describe(ch)
-	c.unsubscribes.Describe(ch)
-	c.unsubscribePercent.Describe(ch)
-}
-
-func (c *EmailUnsubsCollector) Collect(ch chan<- prometheus.Metric) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	body, err := doPostRequest(c.apiURL, "/stats/email_unsubs", c.apiKey, c.debug, "email_unsubs")
-	if err != nil {
-		return
-	}
-
-	var apiResp EmailUnsubsResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		log.Println("[email_unsubs] Failed to parse JSON:", err)
-		return
-	}
-
-	data := apiResp.Data
-	c.emails.Set(data.Emails)
-	c.rejects.Set(data.Rejects)
-	c.unsubscribes.Set(data.Unsubscribes)
-
-	percent, err := strconv.ParseFloat(data.UnsubscribePercent, 64)
-	if err != nil {
-		log.Println("[email_unsubs] Failed to parse unsubscribe_percent:", err)
-	} else {
-		c.unsubscribePercent.Set(percent)
-	}
-
-	c.emails.Collect(ch)
-	c.rejects.Collect(ch)
-	c.unsubscribes.Collect(ch)
-	c.unsubscribePercent.Collect(ch)
+func NewEmailUnsubsCollector(client *Client) *StatsCollector {
+	return NewStatsCollector(EmailUnsubsEndpoint, client)
 }
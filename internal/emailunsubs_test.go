@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestEmailUnsubsCollector(t *testing.T) {
+	_, client := newTestServer(t)
+
+	values := collectValues(t, NewEmailUnsubsCollector(client))
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_unsubs_emails":                                416,
+		"smtp2go_email_unsubs_rejects":                               108,
+		"smtp2go_email_unsubs_unsubscribes":                          4,
+		"smtp2go_email_unsubs_unsubscribe_percent":                   0.75,
+		"smtp2go_email_unsubs_unsubscribe_ratio":                     0.0075,
+		`smtp2go_scrape_collector_success{collector="email_unsubs"}`: 1,
+	})
+}
+
+func TestEmailUnsubsCollectorNumericPercent(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetBody("/stats/email_unsubs", `{"data":{"emails":"10","rejects":"0","unsubscribes":"5","unsubscribe_percent":50}}`)
+
+	values := collectValues(t, NewEmailUnsubsCollector(client))
+	assertValues(t, values, map[string]float64{
+		"smtp2go_email_unsubs_emails":                                10,
+		"smtp2go_email_unsubs_rejects":                               0,
+		"smtp2go_email_unsubs_unsubscribes":                          5,
+		"smtp2go_email_unsubs_unsubscribe_percent":                   50,
+		"smtp2go_email_unsubs_unsubscribe_ratio":                     0.5,
+		`smtp2go_scrape_collector_success{collector="email_unsubs"}`: 1,
+	})
+}
+
+func TestEmailUnsubsCollectorServerError(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetResponse("/stats/email_unsubs", smtp2gotest.Error(http.StatusNotImplemented))
+
+	values := collectValues(t, NewEmailUnsubsCollector(client))
+	assertValues(t, values, map[string]float64{
+		`smtp2go_scrape_collector_success{collector="email_unsubs"}`: 0,
+	})
+}
@@ -0,0 +1,382 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakeapi simulates the SMTP2GO stats API according to a scenario,
+// so that the exporter and the alerting built on it can be exercised without
+// using the quota of a real account.
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cycleLayout is the date format used by SMTP2GO for cycle boundaries.
+const cycleLayout = "2006-01-02 15:04:05-07:00"
+
+// senderStats holds the counters of a sender for the current cycle.
+type senderStats struct {
+	used, bytes, softBounces, hardBounces, spams, unsubscribes, rejects, opens, clicks float64
+}
+
+// Server is an http.Handler simulating the SMTP2GO API. The simulation runs
+// lazily: every request first advances it, tick by tick, up to the current
+// time.
+type Server struct {
+	scenario *Scenario
+	apiKey   string
+	debug    bool
+	now      func() time.Time
+
+	mutex      sync.Mutex
+	rand       *rand.Rand
+	start      time.Time
+	simulated  time.Time
+	cycleStart time.Time
+	// baseUsed is the usage of the cycle not attributed to any sender.
+	baseUsed float64
+	stats    map[string]*senderStats
+}
+
+// NewServer returns a fake API playing scenario from now on. When apiKey is
+// not empty, requests with another key are rejected.
+func NewServer(scenario *Scenario, apiKey string, debug bool) *Server {
+	return newServer(scenario, apiKey, debug, time.Now)
+}
+
+func newServer(scenario *Scenario, apiKey string, debug bool, now func() time.Time) *Server {
+	seed := scenario.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+
+	start := now()
+	s := &Server{
+		scenario:   scenario,
+		apiKey:     apiKey,
+		debug:      debug,
+		now:        now,
+		rand:       rand.New(rand.NewPCG(seed, seed)),
+		start:      start,
+		simulated:  start,
+		cycleStart: start.Add(-scenario.Cycle.Elapsed),
+		baseUsed:   scenario.Cycle.Used,
+	}
+	s.resetStats()
+	return s
+}
+
+func (s *Server) resetStats() {
+	s.stats = map[string]*senderStats{}
+	for _, sender := range s.scenario.Senders {
+		s.stats[sender.Address] = &senderStats{}
+	}
+}
+
+// advance runs the simulation up to t. It must be called with the mutex held.
+func (s *Server) advance(t time.Time) {
+	tick := s.scenario.Tick
+	for !s.simulated.Add(tick).After(t) {
+		from := s.simulated.Sub(s.start)
+		s.simulated = s.simulated.Add(tick)
+		to := s.simulated.Sub(s.start)
+
+		for _, event := range s.scenario.Events {
+			if event.Rollover && event.After > from && event.After <= to {
+				s.rollover(s.simulated)
+			}
+		}
+		for !s.simulated.Before(s.cycleStart.Add(s.scenario.Cycle.Length)) {
+			s.rollover(s.cycleStart.Add(s.scenario.Cycle.Length))
+		}
+
+		for _, sender := range s.scenario.Senders {
+			s.send(s.profile(sender, to), tick)
+		}
+	}
+}
+
+// rollover starts a new cycle at t.
+func (s *Server) rollover(t time.Time) {
+	if s.debug {
+		log.Printf("[fake-api] Cycle rollover at %s", t.Format(time.RFC3339))
+	}
+	s.cycleStart = t
+	s.baseUsed = 0
+	s.resetStats()
+}
+
+// profile returns the sender with the overrides of the events active at
+// elapsed applied.
+func (s *Server) profile(sender Sender, elapsed time.Duration) Sender {
+	for _, event := range s.scenario.Events {
+		if len(event.Set) == 0 || (event.Sender != "" && event.Sender != sender.Address) {
+			continue
+		}
+		if elapsed < event.After || (event.Duration > 0 && elapsed >= event.After+event.Duration) {
+			continue
+		}
+		attributes := sender.attributes()
+		for name, value := range event.Set {
+			*attributes[name] = value
+		}
+	}
+	return sender
+}
+
+// send simulates the emails sent by sender during tick.
+func (s *Server) send(sender Sender, tick time.Duration) {
+	stats := s.stats[sender.Address]
+	count := s.poisson(sender.RatePerMinute * tick.Minutes())
+	for range count {
+		if s.used() >= s.scenario.Cycle.Max || s.chance(sender.RejectRate) {
+			stats.rejects++
+			continue
+		}
+		stats.used++
+		stats.bytes += math.Round(sender.AvgSize * (0.5 + s.rand.Float64()))
+		switch {
+		case s.chance(sender.HardBounceRate):
+			stats.hardBounces++
+			continue
+		case s.chance(sender.SoftBounceRate):
+			stats.softBounces++
+			continue
+		}
+		if s.chance(sender.SpamRate) {
+			stats.spams++
+		}
+		if s.chance(sender.UnsubscribeRate) {
+			stats.unsubscribes++
+		}
+		if s.chance(sender.OpenRate) {
+			stats.opens++
+			if s.chance(sender.ClickRate) {
+				stats.clicks++
+			}
+		}
+	}
+}
+
+func (s *Server) chance(p float64) bool {
+	return p > 0 && s.rand.Float64() < p
+}
+
+// poisson draws the number of events of a Poisson process of mean lambda.
+func (s *Server) poisson(lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	if lambda > 30 {
+		// Normal approximation, good enough for a simulation.
+		return max(0, int(math.Round(lambda+math.Sqrt(lambda)*s.rand.NormFloat64())))
+	}
+	limit, product, count := math.Exp(-lambda), s.rand.Float64(), 0
+	for product > limit {
+		product *= s.rand.Float64()
+		count++
+	}
+	return count
+}
+
+// used returns the usage of the current cycle.
+func (s *Server) used() float64 {
+	used := s.baseUsed
+	for _, stats := range s.stats {
+		used += stats.used
+	}
+	return used
+}
+
+// totals returns the counters summed over all senders.
+func (s *Server) totals() senderStats {
+	var total senderStats
+	for _, stats := range s.stats {
+		total.used += stats.used
+		total.softBounces += stats.softBounces
+		total.hardBounces += stats.hardBounces
+		total.spams += stats.spams
+		total.unsubscribes += stats.unsubscribes
+		total.rejects += stats.rejects
+	}
+	total.used += s.baseUsed
+	return total
+}
+
+func percent(part, total float64) string {
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.2f", part/total*100)
+}
+
+// data returns the data object of the endpoint, or false if the
+// endpoint is unknown. The email history is paginated when limit is set. It
+// must be called with the mutex held.
+func (s *Server) data(endpoint string, limit, offset int) (any, bool) {
+	total := s.totals()
+	switch endpoint {
+	case "/stats/email_cycle":
+		used := s.used()
+		return map[string]any{
+			"cycle_start":     s.cycleStart.UTC().Format(cycleLayout),
+			"cycle_end":       s.cycleStart.Add(s.scenario.Cycle.Length).UTC().Format(cycleLayout),
+			"cycle_used":      used,
+			"cycle_remaining": max(0, s.scenario.Cycle.Max-used),
+			"cycle_max":       s.scenario.Cycle.Max,
+		}, true
+	case "/stats/email_bounces":
+		return map[string]any{
+			"emails":         total.used,
+			"rejects":        total.rejects,
+			"softbounces":    total.softBounces,
+			"hardbounces":    total.hardBounces,
+			"bounce_percent": percent(total.softBounces+total.hardBounces, total.used),
+		}, true
+	case "/stats/email_spam":
+		return map[string]any{
+			"emails":       total.used,
+			"rejects":      total.rejects,
+			"spams":        total.spams,
+			"spam_percent": percent(total.spams, total.used),
+		}, true
+	case "/stats/email_unsubs":
+		return map[string]any{
+			"emails":              total.used,
+			"rejects":             total.rejects,
+			"unsubscribes":        total.unsubscribes,
+			"unsubscribe_percent": percent(total.unsubscribes, total.used),
+		}, true
+	case "/stats/email_history":
+		addresses := make([]string, 0, len(s.stats))
+		for address := range s.stats {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+
+		history := make([]map[string]any, 0, len(addresses))
+		for _, address := range addresses {
+			stats := s.stats[address]
+			avgSize := 0.0
+			if stats.used > 0 {
+				avgSize = stats.bytes / stats.used
+			}
+			history = append(history, map[string]any{
+				"email_address": address,
+				"used":          stats.used,
+				"bytecount":     stats.bytes,
+				"avgsize":       avgSize,
+				"bounces":       stats.softBounces + stats.hardBounces,
+				"clicks":        stats.clicks,
+				"opens":         stats.opens,
+				"rejects":       stats.rejects,
+				"spam":          stats.spams,
+				"unsubscribes":  stats.unsubscribes,
+			})
+		}
+		count := len(history)
+		if limit > 0 {
+			offset = min(max(offset, 0), count)
+			history = history[offset:min(offset+limit, count)]
+		}
+		return map[string]any{"history": history, "count": count}, true
+	}
+	return nil, false
+}
+
+// scripted returns the scripted response of the endpoint at elapsed, if any.
+func (s *Server) scripted(endpoint string, elapsed time.Duration) (ScriptedResponse, bool) {
+	for _, resp := range s.scenario.Responses {
+		if resp.Endpoint != endpoint || elapsed < resp.After || (resp.Until != 0 && elapsed >= resp.Until) {
+			continue
+		}
+		return resp, true
+	}
+	return ScriptedResponse{}, false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		APIKey string `json:"api_key"`
+		Limit  int    `json:"limit"`
+		Offset int    `json:"offset"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(body, &params)
+
+	switch {
+	case r.Method != http.MethodPost:
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	case s.apiKey != "" && params.APIKey != s.apiKey:
+		writeError(w, http.StatusUnauthorized)
+		return
+	}
+
+	now := s.now()
+	s.mutex.Lock()
+	s.advance(now)
+	resp, isScripted := s.scripted(r.URL.Path, now.Sub(s.start))
+	data, known := s.data(r.URL.Path, params.Limit, params.Offset)
+	s.mutex.Unlock()
+
+	if isScripted {
+		if resp.Latency > 0 {
+			select {
+			case <-time.After(resp.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Status != 0 {
+			w.WriteHeader(resp.Status)
+		}
+		io.WriteString(w, resp.Body)
+		return
+	}
+	if !known {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"request_id": requestID(now), "data": data})
+}
+
+func requestID(t time.Time) string {
+	return fmt.Sprintf("fake-%d", t.UnixNano())
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	writeJSON(w, status, map[string]any{
+		"request_id": requestID(time.Now()),
+		"data": map[string]string{
+			"error":      http.StatusText(status),
+			"error_code": "E_ApiResponseCodes.FAKE_API",
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
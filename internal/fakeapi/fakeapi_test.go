@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clock is a manually advanced time source.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func post(t *testing.T, s *Server, endpoint, apiKey string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(`{"api_key":"`+apiKey+`"}`))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v: %s", endpoint, err, rec.Body)
+	}
+	return rec.Code, resp.Data
+}
+
+func testScenario() *Scenario {
+	return &Scenario{
+		Seed: 1,
+		Tick: time.Minute,
+		Cycle: CycleConfig{
+			Max:     10000,
+			Length:  24 * time.Hour,
+			Elapsed: 12 * time.Hour,
+			Used:    100,
+		},
+		Senders: []Sender{
+			{Address: "alice@example.tld", RatePerMinute: 10, AvgSize: 1000, OpenRate: 0.5},
+		},
+		Events: []Event{
+			{After: time.Hour, Duration: time.Hour, Set: map[string]float64{"hard_bounce_rate": 0.5}},
+			{After: 3 * time.Hour, Rollover: true},
+		},
+		Responses: []ScriptedResponse{
+			{Endpoint: "/stats/email_spam", After: 30 * time.Minute, Until: 40 * time.Minute, Status: 503, Body: `{"data":{"error":"down"}}`},
+		},
+	}
+}
+
+func TestServerSimulation(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	c := &clock{t: start}
+	at := func(d time.Duration) { c.t = start.Add(d) }
+	scenario := testScenario()
+	if err := scenario.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(scenario, "key", false, c.now)
+
+	_, cycle := post(t, s, "/stats/email_cycle", "key")
+	if cycle["cycle_used"] != 100.0 || cycle["cycle_start"] != "2025-01-01 00:00:00+00:00" {
+		t.Errorf("unexpected initial cycle %v", cycle)
+	}
+
+	// Usage climbs.
+	at(59 * time.Minute)
+	_, cycle = post(t, s, "/stats/email_cycle", "key")
+	used := cycle["cycle_used"].(float64)
+	if used < 400 || used > 800 {
+		t.Errorf("cycle_used = %v after an hour at 10/min", used)
+	}
+	_, bounces := post(t, s, "/stats/email_bounces", "key")
+	if bounces["hardbounces"] != 0.0 {
+		t.Errorf("hard bounces before the spike: %v", bounces)
+	}
+
+	// Scripted outage.
+	at(35 * time.Minute)
+	if code, _ := post(t, s, "/stats/email_spam", "key"); code != http.StatusServiceUnavailable {
+		t.Errorf("scripted response: got status %d", code)
+	}
+
+	// Bounce spike.
+	at(119 * time.Minute)
+	_, bounces = post(t, s, "/stats/email_bounces", "key")
+	if hard := bounces["hardbounces"].(float64); hard < 100 {
+		t.Errorf("hard bounces after the spike: %v", bounces)
+	}
+	_, history := post(t, s, "/stats/email_history", "key")
+	entries := history["history"].([]any)
+	if len(entries) != 1 || entries[0].(map[string]any)["email_address"] != "alice@example.tld" {
+		t.Errorf("unexpected history %v", history)
+	}
+
+	// Rollover event, then the natural end of the cycle.
+	at(3 * time.Hour)
+	_, cycle = post(t, s, "/stats/email_cycle", "key")
+	if cycle["cycle_start"] != "2025-01-01 15:00:00+00:00" || cycle["cycle_used"].(float64) > 100 {
+		t.Errorf("unexpected cycle after rollover %v", cycle)
+	}
+	at(27 * time.Hour)
+	_, cycle = post(t, s, "/stats/email_cycle", "key")
+	if cycle["cycle_start"] != "2025-01-02 15:00:00+00:00" {
+		t.Errorf("unexpected cycle after its end %v", cycle)
+	}
+}
+
+func TestServerRejects(t *testing.T) {
+	s := NewServer(testScenario(), "key", false)
+	if code, _ := post(t, s, "/stats/email_cycle", "other"); code != http.StatusUnauthorized {
+		t.Errorf("wrong key: got status %d", code)
+	}
+	if code, _ := post(t, s, "/stats/nope", "key"); code != http.StatusNotFound {
+		t.Errorf("unknown endpoint: got status %d", code)
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yml")
+	os.WriteFile(path, []byte(`
+seed: 7
+cycle:
+  max: 500
+  length: 30m
+senders:
+  - address: a@example.tld
+    rate_per_minute: 1
+events:
+  - after: 5m
+    duration: 1m
+    set: {soft_bounce_rate: 2}
+`), 0o600)
+
+	if _, err := LoadScenario(path); err == nil || !strings.Contains(err.Error(), "soft_bounce_rate must be between 0 and 1") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestServerHistoryPages(t *testing.T) {
+	scenario := testScenario()
+	scenario.Senders = append(scenario.Senders,
+		Sender{Address: "bob@example.tld", RatePerMinute: 1},
+		Sender{Address: "carol@example.tld", RatePerMinute: 1},
+	)
+	s := NewServer(scenario, "", false)
+
+	for _, tc := range []struct {
+		body  string
+		first string
+		rows  int
+	}{
+		{`{}`, "alice@example.tld", 3},
+		{`{"limit":2}`, "alice@example.tld", 2},
+		{`{"limit":2,"offset":2}`, "carol@example.tld", 1},
+		{`{"limit":2,"offset":5}`, "", 0},
+	} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stats/email_history", strings.NewReader(tc.body)))
+		var resp struct {
+			Data struct {
+				History []struct {
+					EmailAddress string `json:"email_address"`
+				} `json:"history"`
+				Count int `json:"count"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", tc.body, err)
+		}
+		history := resp.Data.History
+		if resp.Data.Count != 3 || len(history) != tc.rows || (tc.rows > 0 && history[0].EmailAddress != tc.first) {
+			t.Errorf("%s: unexpected response %s", tc.body, rec.Body)
+		}
+	}
+}
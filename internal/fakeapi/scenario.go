@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Scenario drives the fake API: the account and senders it simulates, the
+// events changing their behaviour over time, and scripted responses
+// overriding the simulation.
+type Scenario struct {
+	// Seed makes the random evolution reproducible. Zero picks a random seed.
+	Seed uint64 `yaml:"seed"`
+	// Tick is the simulation step, 10s by default.
+	Tick      time.Duration      `yaml:"tick"`
+	Cycle     CycleConfig        `yaml:"cycle"`
+	Senders   []Sender           `yaml:"senders"`
+	Events    []Event            `yaml:"events"`
+	Responses []ScriptedResponse `yaml:"responses"`
+}
+
+// CycleConfig describes the billing cycle of the simulated account.
+type CycleConfig struct {
+	Max float64 `yaml:"max"`
+	// Length is the duration of a cycle, after which usage rolls over.
+	Length time.Duration `yaml:"length"`
+	// Elapsed is how far into its cycle the account is when the fake API
+	// starts.
+	Elapsed time.Duration `yaml:"elapsed"`
+	// Used is the usage of the cycle when the fake API starts.
+	Used float64 `yaml:"used"`
+}
+
+// Sender is a sender address and the behaviour of the emails it sends. All
+// rates other than RatePerMinute are probabilities between 0 and 1.
+type Sender struct {
+	Address         string  `yaml:"address"`
+	RatePerMinute   float64 `yaml:"rate_per_minute"`
+	AvgSize         float64 `yaml:"avg_size"`
+	SoftBounceRate  float64 `yaml:"soft_bounce_rate"`
+	HardBounceRate  float64 `yaml:"hard_bounce_rate"`
+	SpamRate        float64 `yaml:"spam_rate"`
+	UnsubscribeRate float64 `yaml:"unsubscribe_rate"`
+	RejectRate      float64 `yaml:"reject_rate"`
+	OpenRate        float64 `yaml:"open_rate"`
+	ClickRate       float64 `yaml:"click_rate"`
+}
+
+// Event changes the simulation After a given time since the start of the
+// fake API. Either it rolls the cycle over, or for Duration it overrides
+// attributes of the senders, e.g. {hard_bounce_rate: 0.3} for a bounce spike.
+type Event struct {
+	After    time.Duration `yaml:"after"`
+	Duration time.Duration `yaml:"duration"`
+	// Sender restricts the event to one address; all senders by default.
+	Sender   string             `yaml:"sender"`
+	Set      map[string]float64 `yaml:"set"`
+	Rollover bool               `yaml:"rollover"`
+}
+
+// ScriptedResponse replaces the simulated response of an endpoint between
+// After and Until (forever when zero) since the start of the fake API.
+type ScriptedResponse struct {
+	Endpoint string        `yaml:"endpoint"`
+	After    time.Duration `yaml:"after"`
+	Until    time.Duration `yaml:"until"`
+	// Status defaults to 200.
+	Status int    `yaml:"status"`
+	Body   string `yaml:"body"`
+	// Latency delays the response.
+	Latency time.Duration `yaml:"latency"`
+}
+
+// DefaultScenario is used when no scenario file is given: a small account
+// whose usage climbs over a one hour cycle, with a bounce spike.
+func DefaultScenario() *Scenario {
+	return &Scenario{
+		Tick: 10 * time.Second,
+		Cycle: CycleConfig{
+			Max:    1000,
+			Length: time.Hour,
+		},
+		Senders: []Sender{
+			{
+				Address: "alice@example.tld", RatePerMinute: 10, AvgSize: 7000,
+				SoftBounceRate: 0.01, HardBounceRate: 0.005, SpamRate: 0.001,
+				UnsubscribeRate: 0.005, RejectRate: 0.01, OpenRate: 0.3, ClickRate: 0.05,
+			},
+			{
+				Address: "bob@example.tld", RatePerMinute: 2, AvgSize: 20000,
+				SoftBounceRate: 0.01, OpenRate: 0.5, ClickRate: 0.1,
+			},
+		},
+		Events: []Event{
+			{After: 20 * time.Minute, Duration: 5 * time.Minute, Set: map[string]float64{"hard_bounce_rate": 0.3}},
+		},
+	}
+}
+
+// LoadScenario reads and validates a YAML scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scenario := DefaultScenario()
+	scenario.Senders = nil
+	scenario.Events = nil
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(scenario); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// Validate checks the scenario for errors.
+func (s *Scenario) Validate() error {
+	if s.Tick <= 0 {
+		return fmt.Errorf("tick must be positive")
+	}
+	if s.Cycle.Max < 0 || s.Cycle.Used < 0 {
+		return fmt.Errorf("cycle: max and used must not be negative")
+	}
+	if s.Cycle.Length <= 0 {
+		return fmt.Errorf("cycle: length must be positive")
+	}
+	if s.Cycle.Elapsed < 0 || s.Cycle.Elapsed >= s.Cycle.Length {
+		return fmt.Errorf("cycle: elapsed must be within the cycle length")
+	}
+
+	addresses := map[string]bool{}
+	for _, sender := range s.Senders {
+		if sender.Address == "" {
+			return fmt.Errorf("senders: sender without an address")
+		}
+		if addresses[sender.Address] {
+			return fmt.Errorf("senders: duplicate address %s", sender.Address)
+		}
+		addresses[sender.Address] = true
+		for name, value := range sender.attributes() {
+			if err := checkAttribute(name, *value); err != nil {
+				return fmt.Errorf("senders: %s: %w", sender.Address, err)
+			}
+		}
+	}
+
+	for i, event := range s.Events {
+		if event.After < 0 || event.Duration < 0 {
+			return fmt.Errorf("events[%d]: after and duration must not be negative", i)
+		}
+		if event.Sender != "" && !addresses[event.Sender] {
+			return fmt.Errorf("events[%d]: unknown sender %s", i, event.Sender)
+		}
+		if !event.Rollover && len(event.Set) == 0 {
+			return fmt.Errorf("events[%d]: nothing to do, set either rollover or set", i)
+		}
+		attributes := (&Sender{}).attributes()
+		for name, value := range event.Set {
+			if _, ok := attributes[name]; !ok {
+				return fmt.Errorf("events[%d]: unknown attribute %s", i, name)
+			}
+			if err := checkAttribute(name, value); err != nil {
+				return fmt.Errorf("events[%d]: %w", i, err)
+			}
+		}
+	}
+
+	for i, resp := range s.Responses {
+		if !strings.HasPrefix(resp.Endpoint, "/") {
+			return fmt.Errorf("responses[%d]: endpoint %q must start with /", i, resp.Endpoint)
+		}
+		if resp.Until != 0 && resp.Until <= resp.After {
+			return fmt.Errorf("responses[%d]: until must be after after", i)
+		}
+		if resp.Status != 0 && (resp.Status < 100 || resp.Status > 599) {
+			return fmt.Errorf("responses[%d]: invalid status %d", i, resp.Status)
+		}
+	}
+	return nil
+}
+
+// attributes returns the attributes of the sender that events may override,
+// by name.
+func (s *Sender) attributes() map[string]*float64 {
+	return map[string]*float64{
+		"rate_per_minute":  &s.RatePerMinute,
+		"avg_size":         &s.AvgSize,
+		"soft_bounce_rate": &s.SoftBounceRate,
+		"hard_bounce_rate": &s.HardBounceRate,
+		"spam_rate":        &s.SpamRate,
+		"unsubscribe_rate": &s.UnsubscribeRate,
+		"reject_rate":      &s.RejectRate,
+		"open_rate":        &s.OpenRate,
+		"click_rate":       &s.ClickRate,
+	}
+}
+
+func checkAttribute(name string, value float64) error {
+	if value < 0 {
+		return fmt.Errorf("%s must not be negative", name)
+	}
+	if strings.HasSuffix(name, "_rate") && name != "rate_per_minute" && value > 1 {
+		return fmt.Errorf("%s must be between 0 and 1", name)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenCollectors lists, for every collector, its endpoint and the body of
+// its edge-case response.
+var goldenCollectors = []struct {
+	name string
+	path string
+	new  func(*Client) prometheus.Collector
+	edge string
+}{
+	{
+		name: "email_cycle",
+		path: "/stats/email_cycle",
+		new:  func(c *Client) prometheus.Collector { return NewEmailCycleCollector(c) },
+		// Numbers as strings and an unparsable end of cycle.
+		edge: `{"data":{"cycle_start":"2025-01-01T00:00:00Z","cycle_end":"soon","cycle_used":"1000","cycle_remaining":"0","cycle_max":"1000"}}`,
+	},
+	{
+		name: "email_bounces",
+		path: "/stats/email_bounces",
+		new:  func(c *Client) prometheus.Collector { return NewEmailBouncesCollector(c) },
+		// Percentage with a sign, invalid count.
+		edge: `{"data":{"emails":"8","rejects":null,"softbounces":"x","hardbounces":2,"bounce_percent":"25%"}}`,
+	},
+	{
+		name: "email_spam",
+		path: "/stats/email_spam",
+		new:  func(c *Client) prometheus.Collector { return NewEmailSpamCollector(c) },
+		// No email sent yet: the percentage is empty.
+		edge: `{"data":{"emails":0,"rejects":0,"spams":0,"spam_percent":""}}`,
+	},
+	{
+		name: "email_unsubs",
+		path: "/stats/email_unsubs",
+		new:  func(c *Client) prometheus.Collector { return NewEmailUnsubsCollector(c) },
+		// Percentage given as a number, unknown fields.
+		edge: `{"data":{"emails":4,"rejects":0,"unsubscribes":1,"unsubscribe_percent":25,"new_field":"x"}}`,
+	},
+	{
+		name: "email_history",
+		path: "/stats/email_history",
+		new:  func(c *Client) prometheus.Collector { return NewEmailHistoryCollector(c, EmailHistoryConfig{}, nil) },
+		// Label values needing escaping, and an invalid field.
+		edge: `{"data":{"history":[{"email_address":"\"quoted\"@example.tld","used":1,"bytecount":10,"avgsize":10,"bounces":0,"clicks":0,"opens":0,"rejects":0,"spam":0,"unsubscribes":0},{"email_address":"élodie@exemple.fr","used":"2","bytecount":"n/a","avgsize":"","bounces":"0","clicks":"0","opens":"0","rejects":"0","spam":"0","unsubscribes":"0"}],"count":2}}`,
+	},
+}
+
+// TestGolden compares the output of every collector with the files in
+// testdata. Run "go test ./internal -run TestGolden -update" after an
+// intended change of the metrics to rewrite them.
+func TestGolden(t *testing.T) {
+	setNow(t, testNow)
+
+	for _, collector := range goldenCollectors {
+		for _, tc := range []struct {
+			name string
+			resp *smtp2gotest.Response
+		}{
+			{name: "normal"},
+			{name: "empty", resp: &smtp2gotest.Response{Body: `{"request_id":"aa253464","data":{}}`}},
+			{name: "error", resp: ptr(smtp2gotest.Error(http.StatusUnauthorized))},
+			{name: "malformed", resp: ptr(smtp2gotest.Malformed())},
+			{name: "edge", resp: &smtp2gotest.Response{Body: collector.edge}},
+		} {
+			t.Run(collector.name+"/"+tc.name, func(t *testing.T) {
+				server, client := newTestServer(t)
+				if tc.resp != nil {
+					server.SetResponse(collector.path, *tc.resp)
+				}
+				c := collector.new(client)
+
+				golden := filepath.Join("testdata", collector.name+"_"+tc.name+".golden")
+				if *update {
+					writeGolden(t, golden, c)
+				}
+
+				expected, err := os.Open(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer expected.Close()
+				if err := testutil.CollectAndCompare(c, expected); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// writeGolden writes the current output of c to path.
+func writeGolden(t *testing.T, path string, c prometheus.Collector) {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
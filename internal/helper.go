@@ -15,32 +15,36 @@
 package internal
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
-	"log"
-	"net/http"
+	"fmt"
+	"strings"
+	"time"
 )
 
-func doPostRequest(apiURL, endpoint, apiKey string, debug bool, logPrefix string) ([]byte, error) {
-	fullURL := apiURL + endpoint
+// now returns the current time. Tests replace it to get reproducible output.
+var now = time.Now
 
-	reqBody, _ := json.Marshal(map[string]string{"api_key": apiKey})
-	req, _ := http.NewRequest("POST", fullURL, bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("[%s] HTTP request failed: %v", logPrefix, err)
-		return nil, err
-	}
-	defer resp.Body.Close()
+// timestampLayouts lists the date formats accepted for SMTP2GO timestamps.
+// Fractional seconds are accepted by time.Parse even when the layout does not
+// mention them, so they need no dedicated entry.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	if debug {
-		log.Printf("[%s] Raw response: %s\n", logPrefix, string(body))
+// parseTimestamp parses a timestamp returned by the SMTP2GO API. Timestamps
+// without a zone are interpreted as UTC.
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
 	}
-
-	return body, nil
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", value)
 }
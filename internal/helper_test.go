@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+// testNow is the time the tests pretend it is, in the middle of the cycle of
+// the canned email_cycle response.
+var testNow = time.Date(2025, time.January, 23, 12, 0, 0, 0, time.UTC)
+
+// setNow makes the collectors believe the current time is t for the duration
+// of the test.
+func setNow(tb testing.TB, t time.Time) {
+	tb.Helper()
+	previous := now
+	now = func() time.Time { return t }
+	tb.Cleanup(func() { now = previous })
+}
+
+// newTestServer starts a fake API and returns it with a client using it.
+func newTestServer(tb testing.TB) (*smtp2gotest.Server, *Client) {
+	tb.Helper()
+	server := smtp2gotest.NewServer()
+	server.APIKey = "test-key"
+	tb.Cleanup(server.Close)
+
+	client := NewClient(ClientOptions{
+		APIURL:  server.URL,
+		APIKey:  "test-key",
+		Timeout: 5 * time.Second,
+	})
+	return server, client
+}
+
+// collectValues collects c and returns the value of every series, keyed by
+// metric name followed by its sorted labels, e.g. `name{a="b"}`.
+func collectValues(tb testing.TB, c prometheus.Collector) map[string]float64 {
+	tb.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var labels []string
+			for _, pair := range metric.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%s=%q", pair.GetName(), pair.GetValue()))
+			}
+			sort.Strings(labels)
+			key := family.GetName()
+			if len(labels) > 0 {
+				key += "{" + strings.Join(labels, ",") + "}"
+			}
+			switch {
+			case metric.Gauge != nil:
+				values[key] = metric.GetGauge().GetValue()
+			case metric.Counter != nil:
+				values[key] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+// assertValues checks that values holds exactly the expected series.
+func assertValues(tb testing.TB, values, expected map[string]float64) {
+	tb.Helper()
+	for key, want := range expected {
+		got, ok := values[key]
+		if !ok {
+			tb.Errorf("missing series %s", key)
+		} else if got != want {
+			tb.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	for key := range values {
+		if _, ok := expected[key]; !ok {
+			tb.Errorf("unexpected series %s", key)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)
+	for _, value := range []string{
+		"2025-02-01 00:00:00+00:00",
+		"2025-02-01 01:00:00+01:00",
+		"2025-02-01 00:00:00Z",
+		"2025-02-01T00:00:00Z",
+		"2025-02-01T00:00:00.000000Z",
+		"2025-01-31T19:00:00-0500",
+		"2025-02-01 00:00:00.5 +00:00",
+		"2025-02-01 00:00:00",
+		"2025-02-01",
+		" 2025-02-01T00:00:00Z ",
+	} {
+		got, err := parseTimestamp(value)
+		if err != nil {
+			t.Errorf("parseTimestamp(%q): %v", value, err)
+			continue
+		}
+		if !got.Truncate(time.Second).Equal(want) {
+			t.Errorf("parseTimestamp(%q) = %v, want %v", value, got, want)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "01/02/2025", "2025-02-01 25:00:00"} {
+		if _, err := parseTimestamp(value); err == nil {
+			t.Errorf("parseTimestamp(%q) succeeded, want an error", value)
+		}
+	}
+}
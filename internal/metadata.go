@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric describes a metric family exported by the exporter. The collectors
+// build their descriptors from these descriptions, which the generators and
+// the configuration checks read as well.
+type Metric struct {
+	Name string
+	Help string
+	// Labels are the names of the labels of the family, constant ones
+	// included.
+	Labels []string
+}
+
+// desc returns a descriptor of the metric, setting constLabels among its
+// labels; the other labels are variable.
+func (m Metric) desc(constLabels prometheus.Labels) *prometheus.Desc {
+	var variable []string
+	for _, label := range m.Labels {
+		if _, ok := constLabels[label]; !ok {
+			variable = append(variable, label)
+		}
+	}
+	return prometheus.NewDesc(m.Name, m.Help, variable, constLabels)
+}
+
+// counterOpts returns the options of a counter exporting the metric.
+func (m Metric) counterOpts() prometheus.CounterOpts {
+	return prometheus.CounterOpts{Name: m.Name, Help: m.Help}
+}
+
+// metricLister is implemented by the collectors, listing the metrics their
+// descriptors are built from.
+type metricLister interface {
+	metrics() []Metric
+}
+
+// Metrics returns the metric families exported for an account with cfg, as
+// listed by its client and enabled collectors, sorted by name. Nothing is
+// fetched from the API.
+func Metrics(cfg *Config) []Metric {
+	client := NewClient(ClientOptions{})
+	listed := append(client.metrics(), parseErrorsMetric)
+	for _, collector := range NewCollectors(client, cfg, nil) {
+		listed = append(listed, collector.(metricLister).metrics()...)
+	}
+
+	families := map[string]*Metric{}
+	for _, metric := range listed {
+		family, ok := families[metric.Name]
+		if !ok {
+			family = &Metric{Name: metric.Name, Help: metric.Help}
+			families[metric.Name] = family
+		}
+		for _, label := range metric.Labels {
+			if !slices.Contains(family.Labels, label) {
+				family.Labels = append(family.Labels, label)
+			}
+		}
+	}
+
+	metrics := make([]Metric, 0, len(families))
+	for _, family := range families {
+		sort.Strings(family.Labels)
+		metrics = append(metrics, *family)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
+
+// builtinMetricNames returns the names of the metrics the exporter may export
+// without custom endpoints, whatever the email history settings.
+func builtinMetricNames() []string {
+	cfg := &Config{EmailHistory: EmailHistoryConfig{Series: []string{SeriesAddress, SeriesDomain}}}
+	for grouping := range historyGroupings {
+		cfg.EmailHistory.GroupBy = append(cfg.EmailHistory.GroupBy, grouping)
+	}
+	metrics := Metrics(cfg)
+	names := make([]string, len(metrics))
+	for i, metric := range metrics {
+		names[i] = metric.Name
+	}
+	return names
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+func TestMetrics(t *testing.T) {
+	labels := map[string][]string{}
+	for _, metric := range Metrics(&Config{}) {
+		if metric.Help == "" {
+			t.Errorf("%s has no help", metric.Name)
+		}
+		labels[metric.Name] = metric.Labels
+	}
+	for name, want := range map[string][]string{
+		"smtp2go_email_cycle_used":         nil,
+		"smtp2go_email_history_used":       {"email_address"},
+		"smtp2go_scrape_collector_success": {"collector"},
+		"smtp2go_api_requests_total":       {"code", "endpoint"},
+		"smtp2go_parse_errors_total":       {"collector", "field"},
+	} {
+		got, ok := labels[name]
+		if !ok {
+			t.Errorf("%s not described", name)
+		} else if !slices.Equal(got, want) {
+			t.Errorf("labels of %s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMetricsDisabledCollector(t *testing.T) {
+	disabled := false
+	cfg := &Config{Collectors: map[string]CollectorConfig{"email_cycle": {Enabled: &disabled}}}
+	for _, metric := range Metrics(cfg) {
+		if metric.Name == "smtp2go_email_cycle_used" {
+			t.Errorf("%s described although email_cycle is disabled", metric.Name)
+		}
+	}
+}
+
+// TestMetricsListed checks that every descriptor of the client and the
+// collectors is listed by their metrics method.
+func TestMetricsListed(t *testing.T) {
+	client := NewClient(ClientOptions{RequestsPerSecond: 1})
+	cfg := &Config{
+		EmailHistory: EmailHistoryConfig{Series: []string{SeriesAddress, SeriesDomain}},
+		Endpoints: []EndpointDescriptor{{
+			Name:   "custom",
+			Fields: []FieldDescriptor{{Field: "a", Help: "A"}, {Field: "b", Help: "B"}},
+		}},
+	}
+	for grouping := range historyGroupings {
+		cfg.EmailHistory.GroupBy = append(cfg.EmailHistory.GroupBy, grouping)
+	}
+	collectors := append([]prometheus.Collector{client}, NewCollectors(client, cfg, nil)...)
+	for _, collector := range collectors {
+		ch := make(chan *prometheus.Desc)
+		go func() {
+			collector.Describe(ch)
+			close(ch)
+		}()
+		described := 0
+		for range ch {
+			described++
+		}
+		metrics := collector.(metricLister).metrics()
+		if len(metrics) != described {
+			t.Errorf("%T lists %d metrics, describes %d", collector, len(metrics), described)
+		}
+		for _, metric := range metrics {
+			if !model.LegacyValidation.IsValidMetricName(metric.Name) || metric.Help == "" {
+				t.Errorf("%T lists invalid metric %+v", collector, metric)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	parseErrorsMetric = Metric{
+		Name:   "smtp2go_parse_errors_total",
+		Help:   "Number of API response fields that could not be parsed",
+		Labels: []string{"collector", "field"},
+	}
+	successMetric = Metric{
+		Name:   "smtp2go_scrape_collector_success",
+		Help:   "Whether the last scrape of the collector succeeded",
+		Labels: []string{"collector"},
+	}
+)
+
+// ParseErrors counts response fields that could not be parsed, so that a
+// format change on the SMTP2GO side shows up instead of silently freezing a
+// metric.
+var ParseErrors = prometheus.NewCounterVec(parseErrorsMetric.counterOpts(), parseErrorsMetric.Labels)
+
+// newSuccessDesc returns the descriptor reporting whether the last scrape of
+// the named collector reached the API and got a decodable response.
+func newSuccessDesc(collector string) *prometheus.Desc {
+	return successMetric.desc(prometheus.Labels{"collector": collector})
+}
+
+// sendSuccess reports the outcome of a scrape through the success descriptor.
+func sendSuccess(ch chan<- prometheus.Metric, desc *prometheus.Desc, ok bool) {
+	value := 0.0
+	if ok {
+		value = 1
+	}
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+}
+
+// sendNumber sends n as a gauge, or nothing when the response did not carry a
+// usable value, so that a missing field never shows up as a stale number.
+func sendNumber(ch chan<- prometheus.Metric, desc *prometheus.Desc, collector, field string, n Number, labelValues ...string) bool {
+	if !checkNumber(collector, field, n) {
+		return false
+	}
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, n.Value, labelValues...)
+	return true
+}
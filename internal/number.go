@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Number is a numeric field of an API response. SMTP2GO encodes some values
+// as JSON numbers and others as strings, sometimes with a trailing "%", so
+// Number accepts both. A null or empty value leaves Valid unset; a value that
+// cannot be read as a number also records an error, which is reported through
+// Err instead of failing the decoding of the whole response.
+type Number struct {
+	Value float64
+	Valid bool
+	err   error
+}
+
+func (n *Number) UnmarshalJSON(b []byte) error {
+	*n = Number{}
+
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+
+	text := string(b)
+	if b[0] == '"' {
+		if err := json.Unmarshal(b, &text); err != nil {
+			n.err = err
+			return nil
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), "%")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil
+		}
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		n.err = fmt.Errorf("not a number: %s", b)
+		return nil
+	}
+	n.Value = value
+	n.Valid = true
+	return nil
+}
+
+func (n Number) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Value)
+}
+
+// Err returns the reason the value could not be parsed, if any.
+func (n Number) Err() error {
+	return n.err
+}
+
+// add returns the sum of n and o, ignoring any of them missing.
+func (n Number) add(o Number) Number {
+	switch {
+	case !o.Valid:
+		return Number{Value: n.Value, Valid: n.Valid}
+	case !n.Valid:
+		return Number{Value: o.Value, Valid: true}
+	}
+	return Number{Value: n.Value + o.Value, Valid: true}
+}
+
+// checkNumber reports whether n holds a usable value, logging and counting
+// the failure when the API returned something that is not a number.
+func checkNumber(collector, field string, n Number) bool {
+	if n.Valid {
+		return true
+	}
+	if n.err != nil {
+		log.Printf("[%s] Failed to parse %s: %v", collector, field, n.err)
+		ParseErrors.WithLabelValues(collector, field).Inc()
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNumberUnmarshal(t *testing.T) {
+	for _, tc := range []struct {
+		json  string
+		value float64
+		valid bool
+		err   bool
+	}{
+		{json: `12.5`, value: 12.5, valid: true},
+		{json: `0`, value: 0, valid: true},
+		{json: `"12.5"`, value: 12.5, valid: true},
+		{json: `"12.5%"`, value: 12.5, valid: true},
+		{json: `" 7 % "`, value: 7, valid: true},
+		{json: `"1e3"`, value: 1000, valid: true},
+		{json: `""`},
+		{json: `"%"`},
+		{json: `null`},
+		{json: `"n/a"`, err: true},
+		{json: `true`, err: true},
+		{json: `{}`, err: true},
+	} {
+		var wrapper struct {
+			N Number `json:"n"`
+		}
+		if err := json.Unmarshal([]byte(`{"n":`+tc.json+`}`), &wrapper); err != nil {
+			t.Errorf("%s: unexpected decoding error: %v", tc.json, err)
+			continue
+		}
+		n := wrapper.N
+		if n.Valid != tc.valid || n.Value != tc.value || (n.Err() != nil) != tc.err {
+			t.Errorf("%s: got %+v (err %v), want value %v, valid %v, error %v", tc.json, n, n.Err(), tc.value, tc.valid, tc.err)
+		}
+	}
+}
+
+func TestNumberMarshal(t *testing.T) {
+	data, err := json.Marshal([]Number{{Value: 1.5, Valid: true}, {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[1.5,null]` {
+		t.Errorf("got %s", data)
+	}
+}
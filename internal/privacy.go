@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Privacy modes of the email addresses exported by the email_history
+// collector.
+const (
+	PrivacyHash = "hash"
+	PrivacyMask = "mask"
+)
+
+// lookupRetention is how long the addresses behind a pseudonym can be looked
+// up after they were last exported.
+const lookupRetention = 24 * time.Hour
+
+// PrivacyConfig tells how to pseudonymise the email addresses exported by
+// the email_history collector.
+type PrivacyConfig struct {
+	// Mode is PrivacyHash, replacing the local part of addresses by a keyed
+	// hash of the whole address, PrivacyMask, keeping only the first
+	// character of the local part, or empty to export addresses as is.
+	Mode string `yaml:"mode"`
+	// Exactly one of Secret and SecretFile must be set in hash mode. Keep the
+	// secret to get the same labels across restarts.
+	Secret     string `yaml:"secret"`
+	SecretFile string `yaml:"secret_file"`
+	// Lookup optionally serves the addresses behind pseudonyms.
+	Lookup LookupConfig `yaml:"lookup"`
+}
+
+// LookupConfig is the endpoint serving the addresses behind pseudonyms.
+type LookupConfig struct {
+	// Listen is the address to serve the endpoint on, disabled when empty.
+	// Prefer a local address.
+	Listen string `yaml:"listen"`
+	// Exactly one of Token and TokenFile must be set when the endpoint is
+	// enabled; requests must carry it as a bearer token.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+// Validate checks the mode and that the secrets are set.
+func (c PrivacyConfig) Validate() error {
+	switch c.Mode {
+	case "", PrivacyMask:
+	case PrivacyHash:
+		if (c.Secret == "") == (c.SecretFile == "") {
+			return fmt.Errorf("email_history: privacy: exactly one of secret and secret_file must be set")
+		}
+		if c.SecretFile == "" && strings.TrimSpace(c.Secret) == "" {
+			return fmt.Errorf("email_history: privacy: secret must not be blank")
+		}
+	default:
+		return fmt.Errorf("email_history: privacy: unknown mode %q", c.Mode)
+	}
+	if c.Lookup.Listen != "" {
+		if c.Mode == "" {
+			return fmt.Errorf("email_history: privacy: lookup needs a mode")
+		}
+		if (c.Lookup.Token == "") == (c.Lookup.TokenFile == "") {
+			return fmt.Errorf("email_history: privacy: lookup: exactly one of token and token_file must be set")
+		}
+		if c.Lookup.TokenFile == "" && strings.TrimSpace(c.Lookup.Token) == "" {
+			return fmt.Errorf("email_history: privacy: lookup: token must not be blank")
+		}
+	}
+	return nil
+}
+
+// readSecret returns value, or the content of file when set, failing when
+// the secret is blank.
+func readSecret(value, file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if value = strings.TrimSpace(string(data)); value == "" {
+			return "", fmt.Errorf("%s is empty", file)
+		}
+		return value, nil
+	}
+	if value = strings.TrimSpace(value); value == "" {
+		return "", fmt.Errorf("secret is empty")
+	}
+	return value, nil
+}
+
+// Pseudonymizer replaces email addresses by pseudonyms, remembering the
+// addresses behind them for lookups during lookupRetention.
+type Pseudonymizer struct {
+	mode  string
+	key   []byte
+	token string
+
+	mutex sync.Mutex
+	// seen maps pseudonyms to the addresses behind them and when they were
+	// last exported. Expired addresses are dropped at most once per expired
+	// interval.
+	seen    map[string]map[string]time.Time
+	expired time.Time
+}
+
+// NewPseudonymizer creates the pseudonymizer of a valid configuration, or
+// returns nil when addresses are exported as is.
+func NewPseudonymizer(cfg PrivacyConfig) (*Pseudonymizer, error) {
+	if cfg.Mode == "" {
+		return nil, nil
+	}
+	p := &Pseudonymizer{mode: cfg.Mode, seen: map[string]map[string]time.Time{}}
+	if cfg.Mode == PrivacyHash {
+		secret, err := readSecret(cfg.Secret, cfg.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("email_history: privacy: %w", err)
+		}
+		p.key = []byte(secret)
+	}
+	if cfg.Lookup.Listen != "" {
+		token, err := readSecret(cfg.Lookup.Token, cfg.Lookup.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("email_history: privacy: lookup: %w", err)
+		}
+		p.token = token
+	}
+	return p, nil
+}
+
+// Pseudonymize returns the pseudonym of address, keeping its domain.
+func (p *Pseudonymizer) Pseudonymize(address string) string {
+	local, domain := address, ""
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		local, domain = address[:i], address[i:]
+	}
+
+	var pseudonym string
+	switch p.mode {
+	case PrivacyHash:
+		mac := hmac.New(sha256.New, p.key)
+		mac.Write([]byte(address))
+		pseudonym = hex.EncodeToString(mac.Sum(nil)[:8]) + domain
+	default:
+		first, _ := utf8.DecodeRuneInString(local)
+		if first == utf8.RuneError {
+			pseudonym = "***" + domain
+		} else {
+			pseudonym = string(first) + "***" + domain
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t := now()
+	if t.Sub(p.expired) >= time.Hour {
+		p.expire(t)
+	}
+	if p.seen[pseudonym] == nil {
+		p.seen[pseudonym] = map[string]time.Time{}
+	}
+	p.seen[pseudonym][address] = t
+	return pseudonym
+}
+
+// expire forgets the addresses not exported during lookupRetention.
+func (p *Pseudonymizer) expire(t time.Time) {
+	for pseudonym, addresses := range p.seen {
+		for address, last := range addresses {
+			if t.Sub(last) > lookupRetention {
+				delete(addresses, address)
+			}
+		}
+		if len(addresses) == 0 {
+			delete(p.seen, pseudonym)
+		}
+	}
+	p.expired = t
+}
+
+// Lookup returns the addresses exported behind a pseudonym during
+// lookupRetention, sorted.
+func (p *Pseudonymizer) Lookup(pseudonym string) []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	t := now()
+	var addresses []string
+	for address, last := range p.seen[pseudonym] {
+		if t.Sub(last) <= lookupRetention {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// ServeHTTP answers lookups of the pseudonym given as the email_address
+// query parameter, for requests carrying the configured bearer token.
+func (p *Pseudonymizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || p.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pseudonym := r.URL.Query().Get("email_address")
+	addresses := p.Lookup(pseudonym)
+	if len(addresses) == 0 {
+		http.Error(w, "unknown pseudonym", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"email_address": pseudonym, "addresses": addresses})
+}
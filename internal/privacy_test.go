@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPseudonymizerHash(t *testing.T) {
+	cfg := PrivacyConfig{Mode: PrivacyHash, Secret: "s3cret"}
+	first, err := NewPseudonymizer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := NewPseudonymizer(cfg)
+	other, _ := NewPseudonymizer(PrivacyConfig{Mode: PrivacyHash, Secret: "other"})
+
+	pseudonym := first.Pseudonymize("alice@example.tld")
+	if !regexp.MustCompile(`^[0-9a-f]{16}@example\.tld$`).MatchString(pseudonym) {
+		t.Errorf("unexpected pseudonym %q", pseudonym)
+	}
+	if got := second.Pseudonymize("alice@example.tld"); got != pseudonym {
+		t.Errorf("pseudonym changed with the same secret: %q, then %q", pseudonym, got)
+	}
+	if got := other.Pseudonymize("alice@example.tld"); got == pseudonym {
+		t.Errorf("pseudonym %q did not change with the secret", got)
+	}
+	if got := first.Pseudonymize("alice@example.org"); got[:16] == pseudonym[:16] {
+		t.Errorf("pseudonym %q does not depend on the domain", got)
+	}
+}
+
+func TestPseudonymizerBlankSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []PrivacyConfig{
+		{Mode: PrivacyHash, Secret: "  "},
+		{Mode: PrivacyHash, SecretFile: file},
+		{Mode: PrivacyMask, Lookup: LookupConfig{Listen: "localhost:0", TokenFile: file}},
+	} {
+		if _, err := NewPseudonymizer(cfg); err == nil {
+			t.Errorf("%+v: blank secret accepted", cfg)
+		}
+	}
+	if err := (PrivacyConfig{Mode: PrivacyHash, Secret: " "}).Validate(); err == nil {
+		t.Error("blank secret validated")
+	}
+}
+
+func TestPseudonymizerLookupExpires(t *testing.T) {
+	setNow(t, testNow)
+	p, _ := NewPseudonymizer(PrivacyConfig{Mode: PrivacyMask})
+	p.Pseudonymize("alice@example.tld")
+
+	setNow(t, testNow.Add(lookupRetention))
+	p.Pseudonymize("bob@example.tld")
+	if got := p.Lookup("a***@example.tld"); len(got) != 1 {
+		t.Errorf("Lookup = %v before the retention elapsed", got)
+	}
+
+	setNow(t, testNow.Add(lookupRetention+time.Hour))
+	p.Pseudonymize("bob@example.tld")
+	if got := p.Lookup("a***@example.tld"); len(got) != 0 {
+		t.Errorf("Lookup = %v after the retention elapsed", got)
+	}
+	if len(p.seen) != 1 {
+		t.Errorf("%d pseudonyms remembered, want 1", len(p.seen))
+	}
+}
+
+func TestPseudonymizerMask(t *testing.T) {
+	p, _ := NewPseudonymizer(PrivacyConfig{Mode: PrivacyMask})
+	for address, want := range map[string]string{
+		"alice@example.tld": "a***@example.tld",
+		"élise@example.tld": "é***@example.tld",
+		"@example.tld":      "***@example.tld",
+		"nodomain":          "n***",
+	} {
+		if got := p.Pseudonymize(address); got != want {
+			t.Errorf("Pseudonymize(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
+
+func TestEmailHistoryCollectorPrivacy(t *testing.T) {
+	server, client := newTestServer(t)
+	server.SetBody("/stats/email_history", `{"data":{"history":[
+		{"email_address":"alice@example.tld","used":40},
+		{"email_address":"anna@example.tld","used":2},
+		{"email_address":"bob@example.tld","used":10}
+	],"count":3}}`)
+	p, _ := NewPseudonymizer(PrivacyConfig{Mode: PrivacyMask})
+
+	values := collectValues(t, NewEmailHistoryCollector(client, EmailHistoryConfig{}, p))
+	assertValues(t, values, map[string]float64{
+		`smtp2go_email_history_used{email_address="a***@example.tld"}`: 42,
+		`smtp2go_email_history_used{email_address="b***@example.tld"}`: 10,
+		`smtp2go_email_history_truncated`:                              0,
+		`smtp2go_email_history_dropped_addresses{reason="aggregated"}`: 0,
+		`smtp2go_email_history_dropped_addresses{reason="excluded"}`:   0,
+		`smtp2go_scrape_collector_success{collector="email_history"}`:  1,
+	})
+	if got := p.Lookup("a***@example.tld"); len(got) != 2 || got[0] != "alice@example.tld" || got[1] != "anna@example.tld" {
+		t.Errorf("Lookup = %v", got)
+	}
+}
+
+func TestPseudonymizerLookupEndpoint(t *testing.T) {
+	p, _ := NewPseudonymizer(PrivacyConfig{Mode: PrivacyMask, Lookup: LookupConfig{Listen: "localhost:0", Token: "token"}})
+	p.Pseudonymize("bob@example.tld")
+
+	for _, tc := range []struct {
+		auth   string
+		query  string
+		status int
+	}{
+		{"", "b***@example.tld", http.StatusUnauthorized},
+		{"Bearer wrong", "b***@example.tld", http.StatusUnauthorized},
+		{"Bearer token", "c***@example.tld", http.StatusNotFound},
+		{"Bearer token", "b***@example.tld", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/lookup?email_address="+tc.query, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%q %q: status %d, want %d", tc.auth, tc.query, rec.Code, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var resp struct {
+			Addresses []string `json:"addresses"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Addresses) != 1 || resp.Addresses[0] != "bob@example.tld" {
+			t.Errorf("unexpected response %s (%v)", rec.Body, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNoRecording is returned when replaying an endpoint that has no recorded
+// response.
+var errNoRecording = errors.New("no recorded response")
+
+// replayError is a failure to replay a response: the record directory cannot
+// be read, or holds no response for the endpoint. Retrying does not help.
+type replayError struct {
+	err error
+}
+
+func (e *replayError) Error() string {
+	return "replay: " + e.err.Error()
+}
+
+func (e *replayError) Unwrap() error {
+	return e.err
+}
+
+// redacted replaces the API key in recorded responses.
+const redacted = "REDACTED"
+
+// recordingLayout names recording files so that they sort chronologically.
+const recordingLayout = "20060102T150405.000000000Z"
+
+// recording is an API response saved by -record.dir.
+type recording struct {
+	Time     time.Time      `json:"time"`
+	Endpoint string         `json:"endpoint"`
+	Status   int            `json:"status"`
+	Request  map[string]any `json:"request"`
+	// RetryAfter is the Retry-After header of the response, if any.
+	RetryAfter string `json:"retry_after,omitempty"`
+	// Body holds the response when it is valid JSON, BodyText otherwise.
+	Body     json.RawMessage `json:"body,omitempty"`
+	BodyText string          `json:"body_text,omitempty"`
+}
+
+// body returns the recorded response body.
+func (r *recording) body() []byte {
+	if r.Body != nil {
+		return r.Body
+	}
+	return []byte(r.BodyText)
+}
+
+// record saves a response in the record directory, with the API key
+// redacted. Failures are logged and otherwise ignored.
+func (c *Client) record(endpoint string, params map[string]any, status int, retryAfter string, body []byte) {
+	t := time.Now().UTC()
+	if c.opts.APIKey != "" {
+		body = bytes.ReplaceAll(body, []byte(c.opts.APIKey), []byte(redacted))
+	}
+	request := map[string]any{"api_key": redacted}
+	for name, value := range params {
+		request[name] = value
+	}
+	rec := recording{
+		Time:       t,
+		Endpoint:   endpoint,
+		Status:     status,
+		Request:    request,
+		RetryAfter: retryAfter,
+	}
+	if json.Valid(body) {
+		rec.Body = body
+	} else {
+		rec.BodyText = string(body)
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err == nil {
+		name := t.Format(recordingLayout) + "_" + strings.ReplaceAll(strings.Trim(endpoint, "/"), "/", "_") + ".json"
+		err = os.WriteFile(filepath.Join(c.opts.RecordDir, name), data, 0o600)
+	}
+	if err != nil {
+		log.Printf("[%s] Failed to record response: %v", endpoint, err)
+	}
+}
+
+// replayer serves the responses of a record directory, in order for every
+// endpoint. The last response of an endpoint is served again once all its
+// responses have been replayed.
+type replayer struct {
+	dir string
+
+	mutex      sync.Mutex
+	loaded     bool
+	recordings map[string][]*recording
+	next       map[string]int
+}
+
+func newReplayer(dir string) *replayer {
+	return &replayer{dir: dir}
+}
+
+// load reads the recordings of the directory. It must be called with the
+// mutex held.
+func (r *replayer) load() error {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no recording found in %s", r.dir)
+	}
+	sort.Strings(paths)
+
+	r.recordings = map[string][]*recording{}
+	r.next = map[string]int{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var rec recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		r.recordings[rec.Endpoint] = append(r.recordings[rec.Endpoint], &rec)
+	}
+	r.loaded = true
+	return nil
+}
+
+// replay returns the next recorded response of the endpoint, or a
+// *replayError.
+func (r *replayer) replay(endpoint string) (*recording, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.loaded {
+		if err := r.load(); err != nil {
+			return nil, &replayError{err}
+		}
+	}
+	recordings := r.recordings[endpoint]
+	if len(recordings) == 0 {
+		return nil, &replayError{fmt.Errorf("%w for %s in %s", errNoRecording, endpoint, r.dir)}
+	}
+	i := min(r.next[endpoint], len(recordings)-1)
+	r.next[endpoint] = i + 1
+	return recordings[i], nil
+}
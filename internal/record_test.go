@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	server, _ := newTestServer(t)
+	server.SetBody("/stats/email_spam", `{"data":{"note":"key is test-key"}}`)
+	server.Enqueue("/stats/email_bounces", smtp2gotest.Malformed())
+	recorder := NewClient(ClientOptions{APIURL: server.URL, APIKey: "test-key", RecordDir: dir})
+
+	live := collectValues(t, NewEmailCycleCollector(recorder))
+	for _, path := range []string{"/stats/email_spam", "/stats/email_bounces", "/stats/email_bounces"} {
+		recorder.Fetch(path, "test")
+		// Recordings are named after the time they were made at.
+		time.Sleep(time.Millisecond)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 4 {
+		t.Fatalf("got %d recordings, want 4", len(files))
+	}
+	for _, file := range files {
+		data, _ := os.ReadFile(file)
+		if strings.Contains(string(data), "test-key") {
+			t.Errorf("%s contains the API key: %s", file, data)
+		}
+	}
+
+	// The live scrape happened at the real time, not at testNow.
+	setNow(t, testNow)
+	replayer := NewClient(ClientOptions{APIURL: "http://127.0.0.1:1", ReplayDir: dir})
+	replayed := collectValues(t, NewEmailCycleCollector(replayer))
+	if diff := live["smtp2go_email_cycle_remaining_seconds"] - replayed["smtp2go_email_cycle_remaining_seconds"]; math.Abs(diff) > 1 {
+		t.Errorf("replayed remaining_seconds %v, recorded %v", replayed, live)
+	}
+
+	body, err := replayer.Fetch("/stats/email_spam", "test")
+	if err != nil || compact(t, body) != `{"data":{"note":"key is REDACTED"}}` {
+		t.Errorf("got %s, %v", body, err)
+	}
+	if _, err := replayer.Fetch("/stats/email_bounces", "test"); err != nil {
+		t.Errorf("malformed body not replayed: %v", err)
+	}
+	for range 2 {
+		body, err := replayer.Fetch("/stats/email_bounces", "test")
+		if err != nil || compact(t, body) != smtp2gotest.EmailBouncesBody {
+			t.Errorf("got %s, %v", body, err)
+		}
+	}
+	if _, err := replayer.Fetch("/stats/email_history", "test"); !errors.Is(err, errNoRecording) {
+		t.Errorf("got error %v, want %v", err, errNoRecording)
+	}
+}
+
+// compact returns body without insignificant whitespace, as recordings are
+// indented for readability.
+func compact(t *testing.T, body []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		t.Fatalf("%s: %v", body, err)
+	}
+	return buf.String()
+}
+
+func TestReplayStatus(t *testing.T) {
+	dir := t.TempDir()
+	server, _ := newTestServer(t)
+	server.SetResponse("/stats/email_cycle", smtp2gotest.Error(http.StatusForbidden))
+	recorder := NewClient(ClientOptions{APIURL: server.URL, APIKey: "test-key", RecordDir: dir})
+	recorder.Fetch("/stats/email_cycle", "test")
+
+	replayer := NewClient(ClientOptions{ReplayDir: dir})
+	_, err := replayer.Fetch("/stats/email_cycle", "test")
+	if statusErr, ok := err.(*statusError); !ok || statusErr.code != http.StatusForbidden {
+		t.Errorf("got error %v, want status 403", err)
+	}
+}
+
+func TestReplayLoadError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer := NewClient(ClientOptions{ReplayDir: dir})
+	_, err := replayer.Fetch("/stats/email_cycle", "test")
+	var replayErr *replayError
+	if !errors.As(err, &replayErr) {
+		t.Errorf("got error %v, want a replay error", err)
+	}
+	if got := testutil.ToFloat64(replayer.retries); got != 0 {
+		t.Errorf("retried %v times", got)
+	}
+}
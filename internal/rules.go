@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Names of the generated alerts, shared with the built-in alerting.
+const (
+	AlertCycleQuotaLow                = "SMTP2GOCycleQuotaLow"
+	AlertCycleQuotaExhaustionForecast = "SMTP2GOCycleQuotaExhaustionForecast"
+	AlertBounceRateHigh               = "SMTP2GOBounceRateHigh"
+	AlertSpamRateHigh                 = "SMTP2GOSpamRateHigh"
+	AlertAPICallsFailing              = "SMTP2GOAPICallsFailing"
+	AlertExporterDown                 = "SMTP2GOExporterDown"
+	AlertCollectorFailing             = "SMTP2GOCollectorFailing"
+	AlertAPIUnreachable               = "SMTP2GOAPIUnreachable"
+)
+
+// RuleFile is a Prometheus rule file.
+type RuleFile struct {
+	Groups []RuleGroup `yaml:"groups"`
+}
+
+// RuleGroup is a group of rules of a Prometheus rule file.
+type RuleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is a Prometheus recording or alerting rule.
+type Rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// RuleOptions are the parameters of the generated rules.
+type RuleOptions struct {
+	Thresholds Thresholds
+	// Job is the scrape job of the exporter, watched by the alert on the
+	// exporter being down. No such alert is generated when it is empty.
+	Job string
+	// For is how long a condition must hold before its alert fires.
+	For time.Duration
+	// ForecastRange is the range over which the pace of the cycle usage is
+	// measured to forecast its exhaustion.
+	ForecastRange time.Duration
+	// FailedAPICalls are the levels of the requests to the API which failed
+	// during FailedAPICallsWindow, as checked by the built-in alerting.
+	FailedAPICalls       Threshold
+	FailedAPICallsWindow time.Duration
+}
+
+// DefaultRuleOptions returns the parameters used when none are given.
+func DefaultRuleOptions() RuleOptions {
+	return RuleOptions{
+		Thresholds:    DefaultThresholds(),
+		Job:           "smtp2go",
+		For:           15 * time.Minute,
+		ForecastRange: 6 * time.Hour,
+
+		FailedAPICalls:       DefaultFailedAPICalls(),
+		FailedAPICallsWindow: defaultFailedAPICallsWindow,
+	}
+}
+
+// GenerateRules returns the recording and alerting rules watching metrics,
+// as returned by Metrics. Rules needing a metric which is not exported, or a
+// threshold level which is not set, are left out.
+func GenerateRules(metrics []Metric, opts RuleOptions) RuleFile {
+	exported := map[string]bool{}
+	for _, metric := range metrics {
+		exported[metric.Name] = true
+	}
+	var records, alerts []Rule
+	add := func(rules *[]Rule, rule Rule, needs ...string) {
+		for _, name := range needs {
+			if !exported[name] {
+				return
+			}
+		}
+		*rules = append(*rules, rule)
+	}
+	forDuration := model.Duration(opts.For).String()
+	pace := "smtp2go:email_cycle_used:deriv" + model.Duration(opts.ForecastRange).String()
+
+	add(&records, Rule{
+		Record: "smtp2go:email_cycle_remaining:percent",
+		Expr:   "100 * smtp2go_email_cycle_remaining / (smtp2go_email_cycle_max > 0)",
+	}, "smtp2go_email_cycle_remaining", "smtp2go_email_cycle_max")
+	add(&records, Rule{
+		Record: pace,
+		Expr:   fmt.Sprintf("clamp_min(deriv(smtp2go_email_cycle_used[%s]), 0)", model.Duration(opts.ForecastRange)),
+	}, "smtp2go_email_cycle_used")
+	// Emails left at the end of the cycle if the current pace is kept.
+	add(&records, Rule{
+		Record: "smtp2go:email_cycle_remaining:forecast",
+		Expr:   "smtp2go_email_cycle_remaining - " + pace + " * smtp2go_email_cycle_remaining_seconds",
+	}, "smtp2go_email_cycle_remaining", "smtp2go_email_cycle_used", "smtp2go_email_cycle_remaining_seconds")
+
+	levels := func(name, expr, operator string, threshold Threshold, annotations map[string]string, needs ...string) {
+		for _, level := range []struct {
+			severity string
+			value    *float64
+		}{
+			{"warning", threshold.Warning},
+			{"critical", threshold.Critical},
+		} {
+			if level.value == nil {
+				continue
+			}
+			add(&alerts, Rule{
+				Alert:       name,
+				Expr:        fmt.Sprintf("%s %s %s", expr, operator, strconv.FormatFloat(*level.value, 'f', -1, 64)),
+				For:         forDuration,
+				Labels:      map[string]string{"severity": level.severity},
+				Annotations: annotations,
+			}, needs...)
+		}
+	}
+
+	levels(AlertCycleQuotaLow, "smtp2go:email_cycle_remaining:percent", "<", opts.Thresholds.CycleRemainingPercent, map[string]string{
+		"summary":     "The SMTP2GO cycle quota is running low.",
+		"description": `Only {{ printf "%.2f" $value }}% of the emails of the cycle remain.`,
+	}, "smtp2go_email_cycle_remaining", "smtp2go_email_cycle_max")
+	add(&alerts, Rule{
+		Alert:  AlertCycleQuotaExhaustionForecast,
+		Expr:   "smtp2go:email_cycle_remaining:forecast < 0",
+		For:    forDuration,
+		Labels: map[string]string{"severity": "warning"},
+		Annotations: map[string]string{
+			"summary":     "The SMTP2GO cycle quota will run out before the end of the cycle.",
+			"description": "At the pace of the last " + model.Duration(opts.ForecastRange).String() + `, {{ printf "%.0f" $value }} emails would remain at the end of the cycle.`,
+		},
+	}, "smtp2go_email_cycle_remaining", "smtp2go_email_cycle_used", "smtp2go_email_cycle_remaining_seconds")
+	levels(AlertBounceRateHigh, "smtp2go_email_bounces_bounce_percent", ">", opts.Thresholds.BouncePercent, map[string]string{
+		"summary":     "The SMTP2GO bounce rate is high.",
+		"description": `{{ printf "%.2f" $value }}% of the emails bounced.`,
+	}, "smtp2go_email_bounces_bounce_percent")
+	levels(AlertSpamRateHigh, "smtp2go_email_spam_spam_percent", ">", opts.Thresholds.SpamPercent, map[string]string{
+		"summary":     "The SMTP2GO spam rate is high.",
+		"description": `{{ printf "%.2f" $value }}% of the emails were marked as spam.`,
+	}, "smtp2go_email_spam_spam_percent")
+	if opts.FailedAPICallsWindow > 0 {
+		levels(AlertAPICallsFailing,
+			fmt.Sprintf(`sum without (code, endpoint) (increase(smtp2go_api_requests_total{code!~"2.."}[%s]))`, model.Duration(opts.FailedAPICallsWindow)),
+			">", opts.FailedAPICalls, map[string]string{
+				"summary":     "Requests to the SMTP2GO API are failing.",
+				"description": `{{ printf "%.0f" $value }} requests to the SMTP2GO API failed in the last ` + model.Duration(opts.FailedAPICallsWindow).String() + ".",
+			}, "smtp2go_api_requests_total")
+	}
+
+	if opts.Job != "" {
+		add(&alerts, Rule{
+			Alert:  AlertExporterDown,
+			Expr:   fmt.Sprintf("up{job=%q} == 0", opts.Job),
+			For:    forDuration,
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "The SMTP2GO exporter is down.",
+				"description": "Prometheus cannot scrape {{ $labels.instance }}.",
+			},
+		})
+	}
+	add(&alerts, Rule{
+		Alert:  AlertCollectorFailing,
+		Expr:   "smtp2go_scrape_collector_success == 0",
+		For:    forDuration,
+		Labels: map[string]string{"severity": "warning"},
+		Annotations: map[string]string{
+			"summary":     "An SMTP2GO collector is failing.",
+			"description": "The {{ $labels.collector }} collector cannot fetch its statistics from the SMTP2GO API.",
+		},
+	}, "smtp2go_scrape_collector_success")
+	add(&alerts, Rule{
+		Alert:  AlertAPIUnreachable,
+		Expr:   "smtp2go_api_circuit_state == 1",
+		For:    forDuration,
+		Labels: map[string]string{"severity": "critical"},
+		Annotations: map[string]string{
+			"summary":     "The SMTP2GO API keeps failing.",
+			"description": "Calls to the {{ $labels.endpoint }} endpoint are suspended after repeated failures.",
+		},
+	}, "smtp2go_api_circuit_state")
+
+	var file RuleFile
+	if len(records) > 0 {
+		file.Groups = append(file.Groups, RuleGroup{Name: "smtp2go.rules", Rules: records})
+	}
+	if len(alerts) > 0 {
+		file.Groups = append(file.Groups, RuleGroup{Name: "smtp2go.alerts", Rules: alerts})
+	}
+	return file
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+// alertExprs returns the expressions of the alerts of file, by alert name.
+func alertExprs(file RuleFile) map[string][]string {
+	exprs := map[string][]string{}
+	for _, group := range file.Groups {
+		for _, rule := range group.Rules {
+			if rule.Alert != "" {
+				exprs[rule.Alert] = append(exprs[rule.Alert], rule.Expr)
+			}
+		}
+	}
+	return exprs
+}
+
+func TestGenerateRules(t *testing.T) {
+	file := GenerateRules(Metrics(&Config{}), DefaultRuleOptions())
+	if len(file.Groups) != 2 || len(file.Groups[0].Rules) != 3 {
+		t.Fatalf("unexpected groups %+v", file.Groups)
+	}
+	if got := file.Groups[0].Rules[1].Record; got != "smtp2go:email_cycle_used:deriv6h" {
+		t.Errorf("pace recorded as %s", got)
+	}
+
+	exprs := alertExprs(file)
+	for name, want := range map[string][]string{
+		"SMTP2GOCycleQuotaLow":                {"smtp2go:email_cycle_remaining:percent < 20", "smtp2go:email_cycle_remaining:percent < 10"},
+		"SMTP2GOCycleQuotaExhaustionForecast": {"smtp2go:email_cycle_remaining:forecast < 0"},
+		"SMTP2GOBounceRateHigh":               {"smtp2go_email_bounces_bounce_percent > 5", "smtp2go_email_bounces_bounce_percent > 10"},
+		"SMTP2GOSpamRateHigh":                 {"smtp2go_email_spam_spam_percent > 0.1", "smtp2go_email_spam_spam_percent > 0.3"},
+		"SMTP2GOAPICallsFailing": {
+			`sum without (code, endpoint) (increase(smtp2go_api_requests_total{code!~"2.."}[15m])) > 5`,
+			`sum without (code, endpoint) (increase(smtp2go_api_requests_total{code!~"2.."}[15m])) > 20`,
+		},
+		"SMTP2GOExporterDown":     {`up{job="smtp2go"} == 0`},
+		"SMTP2GOCollectorFailing": {"smtp2go_scrape_collector_success == 0"},
+		"SMTP2GOAPIUnreachable":   {"smtp2go_api_circuit_state == 1"},
+	} {
+		got := exprs[name]
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+			}
+		}
+	}
+}
+
+// TestAlertNames checks that the alerts of the built-in alerting are named
+// after generated rules.
+func TestAlertNames(t *testing.T) {
+	exprs := alertExprs(GenerateRules(Metrics(&Config{}), DefaultRuleOptions()))
+	for check, name := range alertNames {
+		if _, ok := exprs[name]; !ok {
+			t.Errorf("%s: no generated rule %s", check, name)
+		}
+	}
+}
+
+func TestGenerateRulesOptions(t *testing.T) {
+	disabled := false
+	cfg := &Config{Collectors: map[string]CollectorConfig{"email_spam": {Enabled: &disabled}}}
+	level := func(v float64) *float64 { return &v }
+	file := GenerateRules(Metrics(cfg), RuleOptions{
+		Thresholds: Thresholds{BouncePercent: Threshold{Critical: level(8)}},
+		For:        5 * time.Minute,
+	})
+
+	exprs := alertExprs(file)
+	for _, name := range []string{"SMTP2GOSpamRateHigh", "SMTP2GOCycleQuotaLow", "SMTP2GOExporterDown", "SMTP2GOAPICallsFailing"} {
+		if _, ok := exprs[name]; ok {
+			t.Errorf("unexpected alert %s", name)
+		}
+	}
+	if got := exprs["SMTP2GOBounceRateHigh"]; len(got) != 1 || got[0] != "smtp2go_email_bounces_bounce_percent > 8" {
+		t.Errorf("SMTP2GOBounceRateHigh: got %v", got)
+	}
+	for _, rule := range file.Groups[1].Rules {
+		if rule.For != "5m" {
+			t.Errorf("%s: for = %q, want 5m", rule.Alert, rule.For)
+		}
+	}
+}
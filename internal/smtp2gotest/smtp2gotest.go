@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package smtp2gotest provides a fake SMTP2GO API for tests and local
+// development. It serves canned responses for the stats endpoints consumed by
+// the exporter, can be told to fail, slow down or return malformed JSON, and
+// records the requests it receives.
+package smtp2gotest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Canned responses of the stats endpoints, matching the example of the README.
+const (
+	EmailCycleBody = `{"request_id":"aa253464-0bd0-467a-b24b-6159dcd7be60","data":{"cycle_start":"2025-01-01 00:00:00+00:00","cycle_end":"2025-02-01 00:00:00+00:00","cycle_used":522,"cycle_remaining":478,"cycle_max":1000}}`
+
+	EmailBouncesBody = `{"request_id":"aa253464-0bd0-467a-b24b-6159dcd7be61","data":{"emails":414,"rejects":108,"softbounces":3,"hardbounces":5,"bounce_percent":"1.25"}}`
+
+	EmailSpamBody = `{"request_id":"aa253464-0bd0-467a-b24b-6159dcd7be62","data":{"emails":415,"rejects":108,"spams":2,"spam_percent":"0.5"}}`
+
+	EmailUnsubsBody = `{"request_id":"aa253464-0bd0-467a-b24b-6159dcd7be63","data":{"emails":416,"rejects":108,"unsubscribes":4,"unsubscribe_percent":"0.75"}}`
+
+	EmailHistoryBody = `{"request_id":"aa253464-0bd0-467a-b24b-6159dcd7be64","data":{"history":[{"email_address":"alice@example.tld","used":407,"bytecount":3001238,"avgsize":7374.04914004914,"bounces":2,"clicks":10,"opens":120,"rejects":1,"spam":0,"unsubscribes":3},{"email_address":"bob@example.tld","used":7,"bytecount":143384,"avgsize":20483.428571428572,"bounces":0,"clicks":0,"opens":1,"rejects":0,"spam":1,"unsubscribes":0}],"count":2}}`
+)
+
+// MalformedBody is a response body that is not valid JSON.
+const MalformedBody = `{"request_id": "aa253464", "data": {`
+
+// Response describes how the server answers a request.
+type Response struct {
+	// Status defaults to 200.
+	Status int
+	Body   string
+	Header http.Header
+	// Latency delays the response.
+	Latency time.Duration
+}
+
+// Error returns a response with the given HTTP status and an error body
+// shaped like the ones of SMTP2GO.
+func Error(status int) Response {
+	body, _ := json.Marshal(map[string]any{
+		"request_id": "aa253464-0bd0-467a-b24b-6159dcd7be6f",
+		"data": map[string]string{
+			"error":      http.StatusText(status),
+			"error_code": "E_ApiResponseCodes.TEST",
+		},
+	})
+	return Response{Status: status, Body: string(body)}
+}
+
+// Malformed returns a successful response carrying invalid JSON.
+func Malformed() Response {
+	return Response{Body: MalformedBody}
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Path   string
+	APIKey string
+	// Params holds the JSON body of the request.
+	Params map[string]any
+	Time   time.Time
+}
+
+// Server is a fake SMTP2GO API.
+type Server struct {
+	*httptest.Server
+
+	// APIKey, when set, is the only key accepted by the server.
+	APIKey string
+
+	mutex     sync.Mutex
+	responses map[string]Response
+	queues    map[string][]Response
+	requests  []Request
+}
+
+// NewServer starts a server serving the canned responses. It must be closed
+// with Close.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server that is not listening yet, so that its
+// listener or configuration can be changed before calling Start.
+func NewUnstartedServer() *Server {
+	s := &Server{
+		responses: map[string]Response{
+			"/stats/email_cycle":   {Body: EmailCycleBody},
+			"/stats/email_bounces": {Body: EmailBouncesBody},
+			"/stats/email_spam":    {Body: EmailSpamBody},
+			"/stats/email_unsubs":  {Body: EmailUnsubsBody},
+			"/stats/email_history": {Body: EmailHistoryBody},
+		},
+		queues: map[string][]Response{},
+	}
+	s.Server = httptest.NewUnstartedServer(s)
+	return s
+}
+
+// SetResponse sets the response served for path.
+func (s *Server) SetResponse(path string, resp Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[path] = resp
+}
+
+// SetBody sets the body of a successful response served for path.
+func (s *Server) SetBody(path, body string) {
+	s.SetResponse(path, Response{Body: body})
+}
+
+// Enqueue adds responses served once each, in order, for path before falling
+// back to the response set with SetResponse.
+func (s *Server) Enqueue(path string, resps ...Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queues[path] = append(s.queues[path], resps...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestCount returns the number of requests received for path.
+func (s *Server) RequestCount(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, req := range s.requests {
+		if req.Path == path {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	var params map[string]any
+	_ = json.Unmarshal(data, &params)
+	apiKey, _ := params["api_key"].(string)
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, Request{Path: r.URL.Path, APIKey: apiKey, Params: params, Time: time.Now()})
+	resp, ok := s.responses[r.URL.Path]
+	if queue := s.queues[r.URL.Path]; len(queue) > 0 {
+		resp, ok = queue[0], true
+		s.queues[r.URL.Path] = queue[1:]
+	}
+	wantKey := s.APIKey
+	s.mutex.Unlock()
+
+	switch {
+	case r.Method != http.MethodPost:
+		resp = Error(http.StatusMethodNotAllowed)
+	case wantKey != "" && apiKey != wantKey:
+		resp = Error(http.StatusUnauthorized)
+	case !ok:
+		resp = Error(http.StatusNotFound)
+	}
+
+	if resp.Latency > 0 {
+		select {
+		case <-time.After(resp.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != 0 {
+		w.WriteHeader(resp.Status)
+	}
+	io.WriteString(w, resp.Body)
+}
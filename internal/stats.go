@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Parse modes of a FieldDescriptor.
+const (
+	// ParseNumber exports the field as is.
+	ParseNumber = "number"
+	// ParseRatio exports a percentage field as a ratio between 0 and 1.
+	ParseRatio = "ratio"
+	// ParseTimestamp exports a date field as a Unix timestamp in seconds.
+	ParseTimestamp = "timestamp"
+	// ParseSecondsUntil exports the number of seconds until a date field.
+	ParseSecondsUntil = "seconds_until"
+)
+
+// FieldDescriptor maps a field of the "data" object of a stats response to a
+// metric. The same field may be listed several times with different parse
+// modes, e.g. to export a percentage both as is and as a ratio.
+type FieldDescriptor struct {
+	Field string `yaml:"field"`
+	Name  string `yaml:"name"`
+	Help  string `yaml:"help"`
+	// Type is either "gauge" (default) or "counter".
+	Type string `yaml:"type"`
+	// Parse is one of the Parse* modes, ParseNumber by default.
+	Parse string `yaml:"parse"`
+}
+
+// EndpointDescriptor describes a stats endpoint returning a flat "data"
+// object, and the metrics exported from it.
+type EndpointDescriptor struct {
+	// Name identifies the collector in logs and metric labels.
+	Name string `yaml:"name"`
+	// Path defaults to /stats/<name>.
+	Path string `yaml:"path"`
+	// Namespace defaults to smtp2go_<name>.
+	Namespace string            `yaml:"namespace"`
+	Fields    []FieldDescriptor `yaml:"fields"`
+}
+
+// withDefaults returns a copy of e with the optional attributes filled in.
+func (e EndpointDescriptor) withDefaults() EndpointDescriptor {
+	if e.Path == "" {
+		e.Path = "/stats/" + e.Name
+	}
+	if e.Namespace == "" {
+		e.Namespace = "smtp2go_" + e.Name
+	}
+	fields := make([]FieldDescriptor, len(e.Fields))
+	for i, field := range e.Fields {
+		if field.Name == "" {
+			field.Name = field.Field
+		}
+		if field.Type == "" {
+			field.Type = "gauge"
+		}
+		if field.Parse == "" {
+			field.Parse = ParseNumber
+		}
+		fields[i] = field
+	}
+	e.Fields = fields
+	return e
+}
+
+// Validate checks that the descriptor can be turned into a collector.
+func (e EndpointDescriptor) Validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("endpoint has no name")
+	}
+	e = e.withDefaults()
+	if !strings.HasPrefix(e.Path, "/") {
+		return fmt.Errorf("endpoint %s: path %q must start with /", e.Name, e.Path)
+	}
+	if len(e.Fields) == 0 {
+		return fmt.Errorf("endpoint %s: no fields", e.Name)
+	}
+	seen := map[string]bool{}
+	for _, field := range e.Fields {
+		if field.Field == "" {
+			return fmt.Errorf("endpoint %s: field without a JSON name", e.Name)
+		}
+		name := prometheus.BuildFQName(e.Namespace, "", field.Name)
+		if !model.LegacyValidation.IsValidMetricName(name) {
+			return fmt.Errorf("endpoint %s: invalid metric name %q", e.Name, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("endpoint %s: duplicate metric %q", e.Name, name)
+		}
+		seen[name] = true
+		if field.Type != "gauge" && field.Type != "counter" {
+			return fmt.Errorf("endpoint %s: field %s: unknown type %q", e.Name, field.Field, field.Type)
+		}
+		switch field.Parse {
+		case ParseNumber, ParseRatio, ParseTimestamp, ParseSecondsUntil:
+		default:
+			return fmt.Errorf("endpoint %s: field %s: unknown parse mode %q", e.Name, field.Field, field.Parse)
+		}
+	}
+	return nil
+}
+
+// metrics returns the metrics of the fields, in the same order.
+func (e EndpointDescriptor) metrics() []Metric {
+	e = e.withDefaults()
+	metrics := make([]Metric, len(e.Fields))
+	for i, field := range e.Fields {
+		metrics[i] = Metric{Name: prometheus.BuildFQName(e.Namespace, "", field.Name), Help: field.Help}
+	}
+	return metrics
+}
+
+// StatsCollector exports the fields of a stats endpoint as described by an
+// EndpointDescriptor.
+type StatsCollector struct {
+	mutex    sync.Mutex
+	client   *Client
+	endpoint EndpointDescriptor
+
+	descs   []*prometheus.Desc
+	success *prometheus.Desc
+}
+
+// NewStatsCollector returns a collector for the given endpoint. The descriptor
+// is expected to have been checked with Validate.
+func NewStatsCollector(endpoint EndpointDescriptor, client *Client) *StatsCollector {
+	endpoint = endpoint.withDefaults()
+
+	metrics := endpoint.metrics()
+	descs := make([]*prometheus.Desc, len(metrics))
+	for i, metric := range metrics {
+		descs[i] = metric.desc(nil)
+	}
+
+	return &StatsCollector{
+		client:   client,
+		endpoint: endpoint,
+		descs:    descs,
+		success:  newSuccessDesc(endpoint.Name),
+	}
+}
+
+// metrics lists the metrics of the collector, as described by Describe.
+func (c *StatsCollector) metrics() []Metric {
+	return append(c.endpoint.metrics(), successMetric)
+}
+
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+	ch <- c.success
+}
+
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	name := c.endpoint.Name
+	body, err := c.client.Fetch(c.endpoint.Path, name)
+	if err != nil {
+		sendSuccess(ch, c.success, false)
+		return
+	}
+
+	var apiResp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		log.Printf("[%s] Failed to parse JSON: %v", name, err)
+		sendSuccess(ch, c.success, false)
+		return
+	}
+	sendSuccess(ch, c.success, true)
+
+	clock := c.client.clock(c.endpoint.Path)
+	// A field exported several times is only reported once when it fails.
+	failed := map[string]bool{}
+	for i, field := range c.endpoint.Fields {
+		raw, ok := apiResp.Data[field.Field]
+		if !ok {
+			continue
+		}
+		value, ok, err := parseField(field, raw, clock)
+		if err != nil && !failed[field.Field] {
+			failed[field.Field] = true
+			log.Printf("[%s] Failed to parse %s: %v", name, field.Field, err)
+			ParseErrors.WithLabelValues(name, field.Field).Inc()
+		}
+		if !ok {
+			continue
+		}
+		valueType := prometheus.GaugeValue
+		if field.Type == "counter" {
+			valueType = prometheus.CounterValue
+		}
+		ch <- prometheus.MustNewConstMetric(c.descs[i], valueType, value)
+	}
+}
+
+// parseField decodes a raw field according to its parse mode, computing
+// durations relative to now. A null or empty value is reported as missing
+// without an error.
+func parseField(field FieldDescriptor, raw json.RawMessage, now time.Time) (float64, bool, error) {
+	switch field.Parse {
+	case ParseTimestamp, ParseSecondsUntil:
+		var text *string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return 0, false, err
+		}
+		if text == nil || *text == "" {
+			return 0, false, nil
+		}
+		t, err := parseTimestamp(*text)
+		if err != nil {
+			return 0, false, err
+		}
+		if field.Parse == ParseSecondsUntil {
+			return t.Sub(now).Seconds(), true, nil
+		}
+		return float64(t.UnixNano()) / 1e9, true, nil
+	default:
+		var n Number
+		// Number never fails to decode, it records the error instead.
+		_ = json.Unmarshal(raw, &n)
+		if !n.Valid {
+			return 0, false, n.Err()
+		}
+		if field.Parse == ParseRatio {
+			return n.Value / 100, true, nil
+		}
+		return n.Value, true, nil
+	}
+}
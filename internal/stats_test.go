@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatsCollectorCustomEndpoint(t *testing.T) {
+	setNow(t, testNow)
+	server, client := newTestServer(t)
+	server.SetBody("/stats/custom", `{"data":{"total":"42","percent":"12.5%","since":"2025-01-01 00:00:00+00:00","until":"2025-01-24T12:00:00Z","missing":null}}`)
+
+	endpoint := EndpointDescriptor{
+		Name: "custom",
+		Fields: []FieldDescriptor{
+			{Field: "total", Help: "Total", Type: "counter"},
+			{Field: "percent", Name: "ratio", Help: "Ratio", Parse: ParseRatio},
+			{Field: "since", Name: "since_timestamp_seconds", Help: "Start", Parse: ParseTimestamp},
+			{Field: "until", Name: "until_seconds", Help: "Time left", Parse: ParseSecondsUntil},
+			{Field: "missing", Help: "Missing"},
+			{Field: "absent", Help: "Absent"},
+		},
+	}
+	if err := endpoint.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	values := collectValues(t, NewStatsCollector(endpoint, client))
+	assertValues(t, values, map[string]float64{
+		"smtp2go_custom_total":                                 42,
+		"smtp2go_custom_ratio":                                 0.125,
+		"smtp2go_custom_since_timestamp_seconds":               1735689600,
+		"smtp2go_custom_until_seconds":                         24 * 3600,
+		`smtp2go_scrape_collector_success{collector="custom"}`: 1,
+	})
+}
+
+func TestEndpointDescriptorValidate(t *testing.T) {
+	for _, tc := range []struct {
+		endpoint EndpointDescriptor
+		err      string
+	}{
+		{EndpointDescriptor{}, "no name"},
+		{EndpointDescriptor{Name: "x"}, "no fields"},
+		{EndpointDescriptor{Name: "x", Path: "stats/x", Fields: []FieldDescriptor{{Field: "a"}}}, "must start with /"},
+		{EndpointDescriptor{Name: "x", Fields: []FieldDescriptor{{Name: "a"}}}, "without a JSON name"},
+		{EndpointDescriptor{Name: "x", Fields: []FieldDescriptor{{Field: "a-b"}}}, "invalid metric name"},
+		{EndpointDescriptor{Name: "x", Fields: []FieldDescriptor{{Field: "a"}, {Field: "b", Name: "a"}}}, "duplicate metric"},
+		{EndpointDescriptor{Name: "x", Fields: []FieldDescriptor{{Field: "a", Type: "histogram"}}}, "unknown type"},
+		{EndpointDescriptor{Name: "x", Fields: []FieldDescriptor{{Field: "a", Parse: "date"}}}, "unknown parse mode"},
+	} {
+		err := tc.endpoint.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%+v: got error %v, want %q", tc.endpoint, err, tc.err)
+		}
+	}
+
+	for _, endpoint := range []EndpointDescriptor{EmailBouncesEndpoint, EmailSpamEndpoint, EmailUnsubsEndpoint} {
+		if err := endpoint.Validate(); err != nil {
+			t.Errorf("%s: %v", endpoint.Name, err)
+		}
+	}
+}
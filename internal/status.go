@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Status is a snapshot of the statistics of an account, for the commands
+// showing them outside of Prometheus. Statistics which could not be fetched
+// are nil.
+type Status struct {
+	Cycle   *EmailCycleData     `json:"cycle"`
+	Bounces *EmailBouncesData   `json:"bounces"`
+	Spam    *EmailSpamData      `json:"spam"`
+	Unsubs  *EmailUnsubsData    `json:"unsubs"`
+	History []EmailHistoryEntry `json:"history"`
+	// CycleRemaining is the time left until the end of the cycle, if known.
+	CycleRemaining *time.Duration `json:"-"`
+}
+
+// FetchStatus fetches the statistics of the account of client on behalf of
+// the named command, leaving out the email history unless withHistory is set.
+// It returns the statistics it could fetch along with the errors of the
+// others.
+func FetchStatus(client *Client, command string, withHistory bool) (*Status, error) {
+	return loadStatus(client, withHistory, func(endpoint string, v any) error {
+		return fetchJSON(client, endpoint, command, v)
+	})
+}
+
+// CollectedStatus returns the statistics of the account of client last
+// fetched by their collectors, without calling the API, along with the errors
+// of the statistics which were never fetched. Statistics fetched more than
+// maxAge ago, beyond the minimum refresh interval of their collector, are
+// left out as outdated; a zero maxAge keeps them all.
+func CollectedStatus(client *Client, maxAge time.Duration) (*Status, error) {
+	return loadStatus(client, false, func(endpoint string, v any) error {
+		body, fetchedAt, ok := client.Cached(endpoint)
+		if !ok {
+			return fmt.Errorf("%s: not fetched yet", endpoint)
+		}
+		collector := strings.TrimPrefix(endpoint, "/stats/")
+		if age := time.Since(fetchedAt); maxAge > 0 && age > maxAge+client.opts.MinIntervals[collector] {
+			return fmt.Errorf("%s: last fetched %s ago", endpoint, age.Round(time.Second))
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return fmt.Errorf("%s: %w", endpoint, err)
+		}
+		return nil
+	})
+}
+
+// loadStatus decodes the statistics of the account of client obtained with
+// load.
+func loadStatus(client *Client, withHistory bool, load func(endpoint string, v any) error) (*Status, error) {
+	var (
+		status  Status
+		errs    []error
+		cycle   EmailCycleResponse
+		bounces EmailBouncesResponse
+		spam    EmailSpamResponse
+		unsubs  EmailUnsubsResponse
+		history EmailHistoryResponse
+	)
+	if err := load("/stats/email_cycle", &cycle); err != nil {
+		errs = append(errs, err)
+	} else {
+		status.Cycle = &cycle.Data
+		if end, err := parseTimestamp(cycle.Data.CycleEnd); err == nil {
+			remaining := end.Sub(client.clock("/stats/email_cycle"))
+			status.CycleRemaining = &remaining
+		}
+	}
+	if err := load("/stats/email_bounces", &bounces); err != nil {
+		errs = append(errs, err)
+	} else {
+		status.Bounces = &bounces.Data
+	}
+	if err := load("/stats/email_spam", &spam); err != nil {
+		errs = append(errs, err)
+	} else {
+		status.Spam = &spam.Data
+	}
+	if err := load("/stats/email_unsubs", &unsubs); err != nil {
+		errs = append(errs, err)
+	} else {
+		status.Unsubs = &unsubs.Data
+	}
+	if withHistory {
+		if err := load("/stats/email_history", &history); err != nil {
+			errs = append(errs, err)
+		} else {
+			status.History = history.Data.History
+		}
+	}
+	return &status, errors.Join(errs...)
+}
+
+// fetchJSON fetches the endpoint and decodes its response into v.
+func fetchJSON(client *Client, endpoint, collector string, v any) error {
+	body, err := client.Fetch(endpoint, collector)
+	if err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	return nil
+}
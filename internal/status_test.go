@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raspbeguy/smtp2go_exporter/internal/smtp2gotest"
+)
+
+func TestFetchStatus(t *testing.T) {
+	setNow(t, testNow)
+	server, client := newTestServer(t)
+	server.SetResponse("/stats/email_spam", smtp2gotest.Error(400))
+
+	status, err := FetchStatus(client, "status", true)
+	if err == nil || !strings.Contains(err.Error(), "/stats/email_spam") {
+		t.Errorf("got error %v, want one about email_spam", err)
+	}
+	if status.Spam != nil {
+		t.Errorf("unexpected spam statistics %+v", status.Spam)
+	}
+	if status.Cycle == nil || status.Cycle.CycleUsed.Value != 522 {
+		t.Errorf("unexpected cycle %+v", status.Cycle)
+	}
+	if want := 8*24*time.Hour + 12*time.Hour; status.CycleRemaining == nil || *status.CycleRemaining != want {
+		t.Errorf("cycle remaining = %v, want %v", status.CycleRemaining, want)
+	}
+	if status.Bounces == nil || status.Unsubs == nil || len(status.History) != 2 {
+		t.Errorf("incomplete status %+v", status)
+	}
+}
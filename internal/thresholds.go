@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+)
+
+// Severity is the outcome of a check, valued as the exit codes of Nagios
+// plugins.
+type Severity int
+
+const (
+	SeverityOK Severity = iota
+	SeverityWarning
+	SeverityCritical
+	SeverityUnknown
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityOK:
+		return "OK"
+	case SeverityWarning:
+		return "WARNING"
+	case SeverityCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Worse reports whether s is more severe than other. An unknown state ranks
+// between warning and critical.
+func (s Severity) Worse(other Severity) bool {
+	rank := map[Severity]int{SeverityOK: 0, SeverityWarning: 1, SeverityUnknown: 2, SeverityCritical: 3}
+	return rank[s] > rank[other]
+}
+
+// Threshold holds the warning and critical levels of a check.
+type Threshold struct {
+	Warning  *float64 `yaml:"warning"`
+	Critical *float64 `yaml:"critical"`
+}
+
+// Thresholds are the levels the statistics of an account are checked
+// against, in percent.
+type Thresholds struct {
+	// CycleRemainingPercent is breached when the share of the cycle quota
+	// left falls below it.
+	CycleRemainingPercent Threshold `yaml:"cycle_remaining_percent"`
+	// BouncePercent and SpamPercent are breached when the rates rise above
+	// them.
+	BouncePercent Threshold `yaml:"bounce_percent"`
+	SpamPercent   Threshold `yaml:"spam_percent"`
+}
+
+// DefaultThresholds returns the levels used when none are configured.
+func DefaultThresholds() Thresholds {
+	level := func(v float64) *float64 { return &v }
+	return Thresholds{
+		CycleRemainingPercent: Threshold{Warning: level(20), Critical: level(10)},
+		BouncePercent:         Threshold{Warning: level(5), Critical: level(10)},
+		SpamPercent:           Threshold{Warning: level(0.1), Critical: level(0.3)},
+	}
+}
+
+// WithDefaults returns the thresholds with their unset levels taken from
+// DefaultThresholds.
+func (t Thresholds) WithDefaults() Thresholds {
+	defaults := DefaultThresholds()
+	merge := func(t *Threshold, d Threshold) {
+		if t.Warning == nil {
+			t.Warning = d.Warning
+		}
+		if t.Critical == nil {
+			t.Critical = d.Critical
+		}
+	}
+	merge(&t.CycleRemainingPercent, defaults.CycleRemainingPercent)
+	merge(&t.BouncePercent, defaults.BouncePercent)
+	merge(&t.SpamPercent, defaults.SpamPercent)
+	return t
+}
+
+// Validate checks that the levels are percentages, critical ones being
+// beyond warning ones.
+func (t Thresholds) Validate() error {
+	for _, check := range []struct {
+		name      string
+		threshold Threshold
+		below     bool
+	}{
+		{"cycle_remaining_percent", t.CycleRemainingPercent, true},
+		{"bounce_percent", t.BouncePercent, false},
+		{"spam_percent", t.SpamPercent, false},
+	} {
+		for _, level := range []*float64{check.threshold.Warning, check.threshold.Critical} {
+			if level != nil && (*level < 0 || *level > 100) {
+				return fmt.Errorf("thresholds: %s: levels must be between 0 and 100", check.name)
+			}
+		}
+		warning, critical := check.threshold.Warning, check.threshold.Critical
+		if warning == nil || critical == nil {
+			continue
+		}
+		if check.below && *critical > *warning {
+			return fmt.Errorf("thresholds: %s: critical level must not be above the warning one", check.name)
+		}
+		if !check.below && *critical < *warning {
+			return fmt.Errorf("thresholds: %s: critical level must not be below the warning one", check.name)
+		}
+	}
+	return nil
+}
+
+// CheckResult is the evaluation of a statistic against its threshold.
+type CheckResult struct {
+	// Name is the name of the statistic, e.g. "bounce_percent".
+	Name      string
+	Value     Number
+	Threshold Threshold
+	// Below is true when values below the levels breach them.
+	Below    bool
+	Severity Severity
+}
+
+// Evaluate checks the statistics of status against the thresholds. Missing
+// statistics are reported with an unknown severity.
+func (t Thresholds) Evaluate(status *Status) []CheckResult {
+	var remaining Number
+	if cycle := status.Cycle; cycle != nil && cycle.CycleRemaining.Valid && cycle.CycleMax.Valid && cycle.CycleMax.Value > 0 {
+		remaining = Number{Value: 100 * cycle.CycleRemaining.Value / cycle.CycleMax.Value, Valid: true}
+	}
+	var bounces, spam Number
+	if status.Bounces != nil {
+		bounces = status.Bounces.BouncePercent
+	}
+	if status.Spam != nil {
+		spam = status.Spam.SpamPercent
+	}
+
+	return []CheckResult{
+		evaluate("cycle_remaining_percent", remaining, t.CycleRemainingPercent, true),
+		evaluate("bounce_percent", bounces, t.BouncePercent, false),
+		evaluate("spam_percent", spam, t.SpamPercent, false),
+	}
+}
+
+func evaluate(name string, value Number, threshold Threshold, below bool) CheckResult {
+	result := CheckResult{Name: name, Value: value, Threshold: threshold, Below: below}
+	breached := func(level *float64) bool {
+		if level == nil {
+			return false
+		}
+		if below {
+			return value.Value < *level
+		}
+		return value.Value > *level
+	}
+	switch {
+	case !value.Valid:
+		result.Severity = SeverityUnknown
+	case breached(threshold.Critical):
+		result.Severity = SeverityCritical
+	case breached(threshold.Warning):
+		result.Severity = SeverityWarning
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+)
+
+func TestThresholdsEvaluate(t *testing.T) {
+	level := func(v float64) *float64 { return &v }
+	thresholds := Thresholds{
+		CycleRemainingPercent: Threshold{Warning: level(50), Critical: level(10)},
+		BouncePercent:         Threshold{Warning: level(1), Critical: level(2)},
+	}
+	status := &Status{
+		Cycle: &EmailCycleData{
+			CycleRemaining: Number{Value: 478, Valid: true},
+			CycleMax:       Number{Value: 1000, Valid: true},
+		},
+		Bounces: &EmailBouncesData{BouncePercent: Number{Value: 2.5, Valid: true}},
+	}
+
+	results := thresholds.Evaluate(status)
+	want := map[string]Severity{
+		"cycle_remaining_percent": SeverityWarning,
+		"bounce_percent":          SeverityCritical,
+		"spam_percent":            SeverityUnknown,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		if result.Severity != want[result.Name] {
+			t.Errorf("%s: severity %s, want %s", result.Name, result.Severity, want[result.Name])
+		}
+	}
+	if results[0].Value.Value != 47.8 {
+		t.Errorf("cycle remaining = %v, want 47.8", results[0].Value.Value)
+	}
+}
+
+func TestThresholdsValidate(t *testing.T) {
+	if err := DefaultThresholds().Validate(); err != nil {
+		t.Errorf("default thresholds: %v", err)
+	}
+	level := func(v float64) *float64 { return &v }
+	for _, thresholds := range []Thresholds{
+		{CycleRemainingPercent: Threshold{Warning: level(10), Critical: level(20)}},
+		{SpamPercent: Threshold{Warning: level(1), Critical: level(0.5)}},
+		{BouncePercent: Threshold{Warning: level(101)}},
+	} {
+		if err := thresholds.Validate(); err == nil {
+			t.Errorf("%+v: no error", thresholds)
+		}
+	}
+}
+
+func TestSeverityWorse(t *testing.T) {
+	order := []Severity{SeverityOK, SeverityWarning, SeverityUnknown, SeverityCritical}
+	for i := 1; i < len(order); i++ {
+		if !order[i].Worse(order[i-1]) || order[i-1].Worse(order[i]) {
+			t.Errorf("%s should be worse than %s", order[i], order[i-1])
+		}
+	}
+}